@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/blob"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// profileExport is the profile part of a data export.
+type profileExport struct {
+	ID                  int        `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	CreatedAt           time.Time  `json:"created_at"`
+	TimeZone            string     `json:"time_zone"`
+	TwoFactor           bool       `json:"two_factor"`
+	MutedNotifications  []string   `json:"muted_notifications"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+}
+
+// writeJSONFile adds v to the archive as an indented JSON file.
+func writeJSONFile(archive *zip.Writer, name string, v interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(js, '\n'))
+	return err
+}
+
+// exportUserData writes a ZIP archive with everything the app stores about
+// the user: the profile, rooms, tasks, completions, comments and the proof
+// photos they uploaded.
+func (app *application) exportUserData(ctx context.Context, w io.Writer, user *data.User) error {
+	rooms, err := app.models.Users.GetRoomsByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	tasks, err := app.models.Users.GetTasksByUser(user.ID, data.TaskFilters{})
+	if err != nil {
+		return err
+	}
+	history, err := app.models.Stats.GetHistoryByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	comments, err := app.models.Comments.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	proofs, err := app.models.Proofs.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	profile := profileExport{
+		ID:                 user.ID,
+		Name:               user.Name,
+		Email:              user.Email,
+		CreatedAt:          user.CreatedAt,
+		TimeZone:           user.TimeZone,
+		TwoFactor:          user.TOTPEnabled,
+		MutedNotifications: user.MutedNotifications,
+	}
+	if !user.DeletionRequestedAt.IsZero() {
+		profile.DeletionRequestedAt = &user.DeletionRequestedAt
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", profile},
+		{"rooms.json", rooms},
+		{"tasks.json", tasks},
+		{"completions.json", history},
+		{"comments.json", comments},
+		{"proofs.json", proofs},
+	}
+	for _, file := range files {
+		err = writeJSONFile(archive, file.name, file.v)
+		if err != nil {
+			return err
+		}
+	}
+	for _, proof := range proofs {
+		content, err := app.blobs.Get(ctx, proof.ImageKey)
+		if errors.Is(err, blob.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		f, err := archive.Create(fmt.Sprintf("proofs/%d%s", proof.ID, path.Ext(proof.ImageKey)))
+		if err == nil {
+			_, err = io.Copy(f, content)
+		}
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func (app *application) downloadUserData(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	// The archive is built in memory first, so a failure halfway can still
+	// be reported as an error instead of a truncated download.
+	var buf bytes.Buffer
+	err := app.exportUserData(r.Context(), &buf, user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	filename := fmt.Sprintf("birgedo-data-%s.zip", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// requestAccountDeletion schedules the deletion of the user's account. It
+// happens after data.AccountDeletionGrace, and can be cancelled until then.
+func (app *application) requestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("confirm")
+	if form.Get("confirm") != "" && form.Get("confirm") != "DELETE" {
+		form.Errors.Add("confirm", "Type DELETE to confirm")
+	}
+	err = app.confirmIdentity(r, form, "delete_password", user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	version, ok := app.postedVersion(w, r, form)
+	if !ok {
+		return
+	}
+	if !form.Valid() {
+		errs := form.Errors
+		form = settingsForm(user, r.PostForm)
+		form.Errors = errs
+		app.renderSettings(w, r, form)
+		return
+	}
+
+	user.Version = version
+	err = app.models.Users.RequestDeletion(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", "Your settings were changed elsewhere in the meantime. Please review them and try again.")
+			http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditDeletionRequested, "")
+	app.logger.PrintInfo("Account deletion requested", map[string]string{
+		"user": strconv.Itoa(user.ID),
+		"due":  user.DeletionDue().Format(time.RFC3339),
+	})
+	link := fmt.Sprintf("%s/user/settings", strings.TrimRight(app.config.baseURL, "/"))
+	app.background(func() {
+		err := app.mailer.Send(user.Email, "account_deletion.tmpl", map[string]interface{}{
+			"Name": user.Name,
+			"Due":  humanDate(user.DeletionDue()) + " UTC",
+			"Link": link,
+		})
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"email": user.Email})
+		}
+	})
+	days := int(time.Until(user.DeletionDue()).Hours()/24 + 0.5)
+	app.session.Put(r, "flash", fmt.Sprintf("Your account will be deleted in %d days. You can cancel this until then.", days))
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+func (app *application) cancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	if user.DeletionRequestedAt.IsZero() {
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+	err := app.models.Users.CancelDeletion(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", "Your settings were changed elsewhere in the meantime. Please try again.")
+			http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditDeletionCancelled, "")
+	app.logger.PrintInfo("Account deletion cancelled", map[string]string{"user": strconv.Itoa(user.ID)})
+	app.session.Put(r, "flash", "Your account will not be deleted")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// deleteBlobs deletes the blobs of deleted records, logging failures.
+func (app *application) deleteBlobs(keys []string) {
+	for _, key := range keys {
+		err := app.blobs.Delete(context.Background(), key)
+		if err != nil && !errors.Is(err, blob.ErrNotFound) {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+	}
+}
+
+// deleteDueAccounts deletes the accounts whose grace period has passed and
+// the proof photos that went with them.
+func (app *application) deleteDueAccounts() {
+	ids, err := app.models.Users.GetDueDeletions(data.AccountDeletionGrace)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, id := range ids {
+		keys, err := app.models.Users.DeleteAccount(id)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user": strconv.Itoa(id)})
+			continue
+		}
+		app.deleteBlobs(keys)
+		app.audit(nil, 0, id, data.AuditAccountDeleted, "")
+		app.logger.PrintInfo("Deleted account", map[string]string{"user": strconv.Itoa(id)})
+	}
+}
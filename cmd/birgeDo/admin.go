@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// adminPageSize is how many rows the admin console lists per page.
+const adminPageSize = 50
+
+// adminPage is what the pages of the admin console show.
+type adminPage struct {
+	Search   string
+	Action   string
+	Actions  []string
+	Page     int
+	PrevPage int // zero on the first page
+	NextPage int // zero on the last page
+	Users    []data.User
+	Rooms    []data.RoomSummary
+	Audit    []data.AuditEntry
+}
+
+// newAdminPage reads the search and page number from the query string.
+func newAdminPage(r *http.Request) *adminPage {
+	query := r.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return &adminPage{Search: strings.TrimSpace(query.Get("q")), Page: page}
+}
+
+func (p *adminPage) offset() int {
+	return (p.Page - 1) * adminPageSize
+}
+
+// paginate sets the neighbouring pages. Every page is read with one row more
+// than it shows, so n tells whether there is a next page.
+func (p *adminPage) paginate(n int) {
+	if p.Page > 1 {
+		p.PrevPage = p.Page - 1
+	}
+	if n > adminPageSize {
+		p.NextPage = p.Page + 1
+	}
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	page := newAdminPage(r)
+	users, err := app.models.Users.Search(page.Search, adminPageSize+1, page.offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.paginate(len(users))
+	page.Users = users[:min(len(users), adminPageSize)]
+	app.render(w, r, "adminUsers.page.go.html", &templateData{Admin: page})
+}
+
+func (app *application) adminRooms(w http.ResponseWriter, r *http.Request) {
+	page := newAdminPage(r)
+	rooms, err := app.models.Room.GetSummaries(page.Search, adminPageSize+1, page.offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.paginate(len(rooms))
+	page.Rooms = rooms[:min(len(rooms), adminPageSize)]
+	app.render(w, r, "adminRooms.page.go.html", &templateData{Admin: page})
+}
+
+func (app *application) adminAuditLog(w http.ResponseWriter, r *http.Request) {
+	page := newAdminPage(r)
+	page.Actions = data.AuditActions
+	page.Action = r.URL.Query().Get("action")
+	if !slices.Contains(data.AuditActions, page.Action) {
+		page.Action = ""
+	}
+	filters := data.AuditFilters{Action: page.Action, Search: page.Search}
+	entries, err := app.models.Audit.GetAll(filters, adminPageSize+1, page.offset())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page.paginate(len(entries))
+	page.Audit = entries[:min(len(entries), adminPageSize)]
+	app.render(w, r, "adminAudit.page.go.html", &templateData{Admin: page})
+}
+
+// adminTarget returns the user an admin action in the URL is about. It
+// writes the response itself and returns nil when there is none.
+func (app *application) adminTarget(w http.ResponseWriter, r *http.Request) *data.User {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return nil
+	}
+	user, err := app.models.Users.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return nil
+	}
+	return user
+}
+
+// adminDone flashes the outcome of an admin action and goes back to the
+// user it was about.
+func (app *application) adminDone(w http.ResponseWriter, r *http.Request, user *data.User, message string) {
+	app.session.Put(r, "flash", message)
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(user.Email), http.StatusSeeOther)
+}
+
+// deactivateUser locks a user out: they are logged out everywhere and cannot
+// log in again until they are reactivated.
+func (app *application) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	admin := app.authenticatedUser(r)
+	user := app.adminTarget(w, r)
+	if user == nil {
+		return
+	}
+	if user.ID == admin.ID {
+		app.adminDone(w, r, user, "You cannot deactivate your own account")
+		return
+	}
+	err := app.models.Users.SetDeactivated(user.ID, true)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.session.Store.DeleteByUser(r.Context(), user.ID, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, admin.ID, user.ID, data.AuditAdminDeactivated, "")
+	app.adminDone(w, r, user, fmt.Sprintf("%s was deactivated", user.Email))
+}
+
+func (app *application) reactivateUser(w http.ResponseWriter, r *http.Request) {
+	admin := app.authenticatedUser(r)
+	user := app.adminTarget(w, r)
+	if user == nil {
+		return
+	}
+	err := app.models.Users.SetDeactivated(user.ID, false)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, admin.ID, user.ID, data.AuditAdminReactivated, "")
+	app.adminDone(w, r, user, fmt.Sprintf("%s was reactivated", user.Email))
+}
+
+// forcePasswordReset logs the user out everywhere and makes them choose a new
+// password once they log in again.
+func (app *application) forcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	admin := app.authenticatedUser(r)
+	user := app.adminTarget(w, r)
+	if user == nil {
+		return
+	}
+	err := app.models.Users.RequirePasswordReset(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.session.Store.DeleteByUser(r.Context(), user.ID, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, admin.ID, user.ID, data.AuditAdminPasswordReset, "")
+	app.adminDone(w, r, user, fmt.Sprintf("%s has to choose a new password at their next login", user.Email))
+}
+
+// resetTwoFactor lets an admin turn off two-factor authentication for a user
+// who lost both their device and their recovery codes.
+func (app *application) resetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	admin := app.authenticatedUser(r)
+	user := app.adminTarget(w, r)
+	if user == nil {
+		return
+	}
+	if !user.TOTPEnabled {
+		app.adminDone(w, r, user, fmt.Sprintf("%s has not enabled two-factor authentication", user.Email))
+		return
+	}
+	err := app.models.TwoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.logger.PrintInfo("Reset two-factor authentication", map[string]string{
+		"admin": admin.Email,
+		"user":  user.Email,
+	})
+	app.audit(r, admin.ID, user.ID, data.AuditAdminTwoFactorReset, "")
+	app.adminDone(w, r, user, fmt.Sprintf("Two-factor authentication of %s was reset", user.Email))
+}
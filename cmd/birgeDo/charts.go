@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// chartBar is a single bar of a chart: a label and a percentage between 0
+// and 100 together with the text shown next to it.
+type chartBar struct {
+	Label   string
+	Percent int
+	Caption string
+}
+
+const (
+	chartWidth      = 600
+	chartLabelWidth = 160
+	chartBarHeight  = 22
+	chartColumnArea = 160
+)
+
+// barChart renders bars as a horizontal SVG bar chart, one row per bar.
+func barChart(bars []chartBar) template.HTML {
+	if len(bars) == 0 {
+		return ""
+	}
+	barArea := chartWidth - chartLabelWidth - 80
+	height := len(bars)*(chartBarHeight+8) + 8
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img">`, chartWidth, height)
+	for i, bar := range bars {
+		y := 8 + i*(chartBarHeight+8)
+		width := barArea * clampPercent(bar.Percent) / 100
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" class="chart-label">%s</text>`,
+			chartLabelWidth-8, y+chartBarHeight-6, template.HTMLEscapeString(truncate(bar.Label, 22)))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" class="chart-track"/>`,
+			chartLabelWidth, y, barArea, chartBarHeight)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" class="chart-bar"><title>%s</title></rect>`,
+			chartLabelWidth, y, width, chartBarHeight, template.HTMLEscapeString(bar.Caption))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" class="chart-value">%s</text>`,
+			chartLabelWidth+barArea+8, y+chartBarHeight-6, template.HTMLEscapeString(bar.Caption))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// columnChart renders bars as an SVG column chart, left to right, with the
+// labels of the first and the last column below the axis.
+func columnChart(bars []chartBar) template.HTML {
+	if len(bars) == 0 {
+		return ""
+	}
+	step := chartWidth / len(bars)
+	height := chartColumnArea + 24
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img">`, chartWidth, height)
+	fmt.Fprintf(&b, `<line x1="0" y1="%d" x2="%d" y2="%d" class="chart-axis"/>`, chartColumnArea, chartWidth, chartColumnArea)
+	for i, bar := range bars {
+		h := chartColumnArea * clampPercent(bar.Percent) / 100
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" class="chart-bar"><title>%s: %s</title></rect>`,
+			i*step+1, chartColumnArea-h, step-2, h,
+			template.HTMLEscapeString(bar.Label), template.HTMLEscapeString(bar.Caption))
+	}
+	fmt.Fprintf(&b, `<text x="0" y="%d" class="chart-label">%s</text>`,
+		height-6, template.HTMLEscapeString(bars[0].Label))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" class="chart-label">%s</text>`,
+		chartWidth, height-6, template.HTMLEscapeString(bars[len(bars)-1].Label))
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func clampPercent(percent int) int {
+	switch {
+	case percent < 0:
+		return 0
+	case percent > 100:
+		return 100
+	}
+	return percent
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/internal/jsonlog"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// minPasswordLength is the shortest password accepted, on the site and from
+// the command line.
+const minPasswordLength = 10
+
+var commands = map[string]func(args []string) error{
+	"serve":  serve,
+	"user":   userCommand,
+	"room":   roomCommand,
+	"tasks":  tasksCommand,
+	"export": exportCommand,
+}
+
+const usageText = `Usage: birgeDo <command> [flags] [arguments]
+
+Commands:
+  serve                                   run the web site (the default)
+  help                                    show this help
+  user create -name N -email E [-password P] [-admin]
+  user activate <email>                   activate and reactivate an account
+  user reset-password [-password P] <email>
+  user promote [-demote] <email>          grant or revoke admin access
+  room list [-q search]
+  room delete -yes <id>
+  tasks reset [-room id]                  reset the tasks due for a reset
+  export [-o file] <email>                write a user's data archive
+
+Every command accepts the settings flags of serve, such as -db-dsn and
+-upload-dir. Run "birgeDo <command> -h" to list them. Settings are read
+from their defaults, then the YAML file given by -config or BIRGEDO_CONFIG,
+then environment variables such as BIRGEDO_DB_DSN, and finally the flags.
+In the file, -db-max-open-conns is written as max_open_conns under db.
+`
+
+func usage() {
+	fmt.Fprint(os.Stderr, usageText)
+}
+
+// errUsage is returned for a command line that does not name a subcommand
+// or lacks an argument.
+var errUsage = errors.New("invalid command line, see birgeDo help")
+
+// cliApplication opens the database for a command. Only errors are logged,
+// so the output of the command stays readable.
+func cliApplication(cfg config) (*application, error) {
+	return newApplication(cfg, jsonlog.New(os.Stderr, jsonlog.LevelError))
+}
+
+// subcommand splits the name of a subcommand off args.
+func subcommand(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", nil, errUsage
+	}
+	return args[0], args[1:], nil
+}
+
+// userByEmail looks up the user an argument names.
+func (app *application) userByEmail(email string) (*data.User, error) {
+	user, err := app.models.Users.GetByEmail(email)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user with email %s", email)
+	}
+	return user, err
+}
+
+// cliPassword returns the password given on the command line, or generates
+// one when none was given. It reports whether it did.
+func cliPassword(password string) (string, bool, error) {
+	if password == "" {
+		password, err := randomKey()
+		return password, true, err
+	}
+	if len(password) < minPasswordLength {
+		return "", false, fmt.Errorf("the password must be at least %d characters long", minPasswordLength)
+	}
+	return password, false, nil
+}
+
+func userCommand(args []string) error {
+	name, args, err := subcommand(args)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	fs := newFlagSet("user "+name, &cfg)
+	switch name {
+	case "create":
+		userName := fs.String("name", "", "Name of the user")
+		email := fs.String("email", "", "Email address of the user")
+		password := fs.String("password", "", "Password of the user, generated if empty")
+		admin := fs.Bool("admin", false, "Give the user access to the admin console")
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		return createUser(cfg, *userName, *email, *password, *admin)
+	case "activate":
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		return withUser(cfg, fs, activateUser)
+	case "reset-password":
+		password := fs.String("password", "", "New password, generated if empty")
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		return withUser(cfg, fs, func(app *application, user *data.User) error {
+			return resetPassword(app, user, *password)
+		})
+	case "promote":
+		demote := fs.Bool("demote", false, "Revoke admin access instead")
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		return withUser(cfg, fs, func(app *application, user *data.User) error {
+			return promoteUser(app, user, !*demote)
+		})
+	default:
+		return errUsage
+	}
+}
+
+// withUser runs fn for the user whose email is the only argument left in fs.
+func withUser(cfg config, fs *flag.FlagSet, fn func(*application, *data.User) error) error {
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	app, err := cliApplication(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.db.Close()
+
+	user, err := app.userByEmail(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return fn(app, user)
+}
+
+func createUser(cfg config, name, email, password string, admin bool) error {
+	form := forms.New(url.Values{
+		"name":  {strings.TrimSpace(name)},
+		"email": {strings.TrimSpace(email)},
+	})
+	form.Required("name", "email")
+	form.MaxLength("name", maxNameLength)
+	form.MatchesPattern("email", forms.EmailRX)
+	for _, field := range []string{"name", "email"} {
+		if msg := form.Errors.Get(field); msg != "" {
+			return fmt.Errorf("%s: %s", field, msg)
+		}
+	}
+	password, generated, err := cliPassword(password)
+	if err != nil {
+		return err
+	}
+
+	app, err := cliApplication(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.db.Close()
+
+	user := &data.User{
+		Name:      form.Get("name"),
+		Email:     form.Get("email"),
+		Activated: true,
+	}
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			return fmt.Errorf("a user with email %s already exists", user.Email)
+		}
+		return err
+	}
+	if admin {
+		err = promoteUser(app, user, true)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Created user %d <%s>\n", user.ID, user.Email)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+// activateUser marks the account activated and lifts a deactivation by an
+// admin.
+func activateUser(app *application, user *data.User) error {
+	if !user.Activated {
+		user.Activated = true
+		err := app.models.Users.Update(user)
+		if err != nil {
+			return err
+		}
+	}
+	if !user.DeactivatedAt.IsZero() {
+		err := app.models.Users.SetDeactivated(user.ID, false)
+		if err != nil {
+			return err
+		}
+		app.audit(nil, 0, user.ID, data.AuditAdminReactivated, "command line")
+	}
+	fmt.Printf("Activated %s\n", user.Email)
+	return nil
+}
+
+// resetPassword sets a new password, which also logs the user out
+// everywhere.
+func resetPassword(app *application, user *data.User, password string) error {
+	password, generated, err := cliPassword(password)
+	if err != nil {
+		return err
+	}
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		return err
+	}
+	app.audit(nil, 0, user.ID, data.AuditPasswordChanged, "command line")
+	fmt.Printf("Changed the password of %s\n", user.Email)
+	if generated {
+		fmt.Printf("Password: %s\n", password)
+	}
+	return nil
+}
+
+func promoteUser(app *application, user *data.User, admin bool) error {
+	err := app.models.Users.SetAdmin(user.ID, admin)
+	if err != nil {
+		return err
+	}
+	if admin {
+		app.audit(nil, 0, user.ID, data.AuditAdminPromoted, "command line")
+		fmt.Printf("%s is now an admin\n", user.Email)
+	} else {
+		app.audit(nil, 0, user.ID, data.AuditAdminDemoted, "command line")
+		fmt.Printf("%s is no longer an admin\n", user.Email)
+	}
+	return nil
+}
+
+func roomCommand(args []string) error {
+	name, args, err := subcommand(args)
+	if err != nil {
+		return err
+	}
+	var cfg config
+	fs := newFlagSet("room "+name, &cfg)
+	switch name {
+	case "list":
+		search := fs.String("q", "", "Only list rooms whose title contains this")
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		return listRooms(cfg, *search)
+	case "delete":
+		yes := fs.Bool("yes", false, "Confirm the deletion")
+		if err := loadConfig(fs, &cfg, args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errUsage
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid room id %q", fs.Arg(0))
+		}
+		return deleteRoom(cfg, id, *yes)
+	default:
+		return errUsage
+	}
+}
+
+func listRooms(cfg config, search string) error {
+	app, err := cliApplication(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.db.Close()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tMEMBERS\tTASKS\tADMINS")
+	for offset := 0; ; offset += adminPageSize {
+		rooms, err := app.models.Room.GetSummaries(search, adminPageSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, room := range rooms {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%s\n", room.Room.ID, room.Room.Title, room.Members, room.Tasks, strings.Join(room.Admins, ", "))
+		}
+		if len(rooms) < adminPageSize {
+			break
+		}
+	}
+	return tw.Flush()
+}
+
+// deleteRoom deletes a room with everything in it. Without yes it only tells
+// what would be deleted.
+func deleteRoom(cfg config, id int64, yes bool) error {
+	app, err := cliApplication(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.db.Close()
+
+	room, err := app.models.Room.GetByID(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no room with id %d", id)
+		}
+		return err
+	}
+	if !yes {
+		return fmt.Errorf("room %d %q and all its tasks and history would be deleted, add -yes to do so", room.ID, room.Title)
+	}
+	keys, err := app.models.Room.Delete(id)
+	if err != nil {
+		return err
+	}
+	app.deleteBlobs(keys)
+	fmt.Printf("Deleted room %d %q\n", room.ID, room.Title)
+	return nil
+}
+
+// tasksCommand wraps the daily reset for running it by hand, for example
+// after the server was down at midnight. Unlike the scheduled job it does not
+// record history or rotate assignments.
+func tasksCommand(args []string) error {
+	name, args, err := subcommand(args)
+	if err != nil {
+		return err
+	}
+	if name != "reset" {
+		return errUsage
+	}
+	var cfg config
+	fs := newFlagSet("tasks reset", &cfg)
+	roomID := fs.Int64("room", 0, "Only reset the tasks of this room")
+	if err := loadConfig(fs, &cfg, args); err != nil {
+		return err
+	}
+
+	app, err := cliApplication(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.db.Close()
+
+	if *roomID == 0 {
+		err = app.models.Task.ResetAllTasks()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Reset the tasks of all rooms")
+		return nil
+	}
+	_, err = app.models.Room.GetByID(*roomID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no room with id %d", *roomID)
+		}
+		return err
+	}
+	err = app.models.Task.ResetRoomTasks(*roomID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reset the tasks of room %d\n", *roomID)
+	return nil
+}
+
+// exportCommand writes the same archive a user downloads from their
+// settings, for requests that reach the operators instead.
+func exportCommand(args []string) error {
+	var cfg config
+	fs := newFlagSet("export", &cfg)
+	output := fs.String("o", "", `Output file, "-" for standard output (default birgedo-data-<id>-<date>.zip)`)
+	if err := loadConfig(fs, &cfg, args); err != nil {
+		return err
+	}
+
+	return withUser(cfg, fs, func(app *application, user *data.User) error {
+		if *output == "-" {
+			return app.exportUserData(context.Background(), os.Stdout, user)
+		}
+		path := *output
+		if path == "" {
+			path = fmt.Sprintf("birgedo-data-%d-%s.zip", user.ID, time.Now().Format("2006-01-02"))
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = app.exportUserData(context.Background(), f, user)
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+		return nil
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const maxCommentLength = 5000
+
+var mentionRX = regexp.MustCompile(`@([\p{L}\p{N}._-]+)`)
+
+// mentionedMembers returns the room members mentioned in body. A member is
+// mentioned as @ followed by their name without spaces or by the local part
+// of their email address, in any case.
+func mentionedMembers(body string, members []data.User) []data.User {
+	handles := make(map[string]bool)
+	for _, match := range mentionRX.FindAllStringSubmatch(body, -1) {
+		handles[strings.ToLower(strings.TrimRight(match[1], "._-"))] = true
+	}
+	var mentioned []data.User
+	for _, member := range members {
+		name := strings.ToLower(strings.Join(strings.Fields(member.Name), ""))
+		local := strings.ToLower(strings.SplitN(member.Email, "@", 2)[0])
+		if handles[name] || handles[local] {
+			mentioned = append(mentioned, member)
+		}
+	}
+	return mentioned
+}
+
+// notifyMentions notifies the members mentioned in a comment, skipping its
+// author and everyone in skip.
+func (app *application) notifyMentions(comment *data.Comment, task *data.Task, author *data.User, skip []data.User) {
+	members, err := app.models.Users.GetMembersByRoom(task.RoomID)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	notified := map[int]bool{author.ID: true}
+	for _, user := range skip {
+		notified[user.ID] = true
+	}
+	for _, user := range mentionedMembers(comment.Body, members) {
+		if notified[user.ID] {
+			continue
+		}
+		app.notify(user.ID, data.NotificationMention,
+			fmt.Sprintf("%s mentioned you on %q", author.Name, task.Title),
+			fmt.Sprintf("/task/%d/view#comment-%d", task.ID, comment.ID))
+	}
+}
+
+// roomComment loads the comment from the id parameter together with its task
+// and makes sure the authenticated user is a member of the task's room.
+func (app *application) roomComment(w http.ResponseWriter, r *http.Request) (*data.Comment, *data.Task, bool) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return nil, nil, false
+	}
+	comment, err := app.models.Comments.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return nil, nil, false
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	}
+	task, err := app.models.Task.GetByID(comment.TaskID)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	}
+	ok, err := app.userInRoom(user.ID, task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	} else if !ok {
+		app.notFound(w)
+		return nil, nil, false
+	}
+	return comment, task, true
+}
+
+func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	task, _, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("body")
+	form.MaxLength("body", maxCommentLength)
+	if !form.Valid() {
+		app.session.Put(r, "flash", "Comment: "+form.Errors.Get("body"))
+		http.Redirect(w, r, fmt.Sprintf("/task/%d/view", task.ID), http.StatusSeeOther)
+		return
+	}
+
+	comment := &data.Comment{TaskID: task.ID, UserID: user.ID, Body: form.Get("body")}
+	err = app.models.Comments.Insert(comment)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.recordActivity(task.RoomID, user.ID, task.ID, data.ActivityCommented)
+	app.notifyMentions(comment, task, user, nil)
+	http.Redirect(w, r, fmt.Sprintf("/task/%d/view#comment-%d", task.ID, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) editComment(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	comment, task, ok := app.roomComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserID != user.ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("body")
+	form.MaxLength("body", maxCommentLength)
+	if !form.Valid() {
+		app.session.Put(r, "flash", "Comment: "+form.Errors.Get("body"))
+		http.Redirect(w, r, fmt.Sprintf("/task/%d/view#comment-%d", task.ID, comment.ID), http.StatusSeeOther)
+		return
+	}
+
+	members, err := app.models.Users.GetMembersByRoom(task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	mentioned := mentionedMembers(comment.Body, members)
+	comment.Body = form.Get("body")
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", fmt.Sprintf("Comments can only be edited for %d minutes after posting", int(data.CommentEditWindow.Minutes())))
+		default:
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		// Members mentioned before the edit have been notified already.
+		app.notifyMentions(comment, task, user, mentioned)
+	}
+	http.Redirect(w, r, fmt.Sprintf("/task/%d/view#comment-%d", task.ID, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	comment, task, ok := app.roomComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserID != user.ID {
+		admin, err := app.models.Users.IsRoomAdmin(user.ID, task.RoomID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if !admin {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+	}
+	err := app.models.Comments.Delete(comment.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Put(r, "flash", "Comment deleted")
+	http.Redirect(w, r, fmt.Sprintf("/task/%d/view", task.ID), http.StatusSeeOther)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"net/http"
+)
+
+// streakRisk is a room in which the user has a running streak that ends
+// unless the pending tasks are finished today.
+type streakRisk struct {
+	RoomID    int64
+	RoomTitle string
+	Days      int
+	Pending   int
+}
+
+// dashboard is the home page of an authenticated user: today's pending tasks
+// across all rooms, streaks at risk and the latest activity in their rooms.
+func (app *application) dashboard(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+
+	tasks, err := app.models.Users.GetTasksByUser(user.ID, data.TaskFilters{Done: "pending"})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	streaks, err := app.models.Stats.GetCurrentStreaks(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	activities, err := app.models.Activity.GetForUser(user.ID, 15)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var risks []streakRisk
+	seen := make(map[int64]int)
+	for _, task := range tasks {
+		days := streaks[task.RoomID]
+		if days == 0 {
+			continue
+		}
+		i, ok := seen[task.RoomID]
+		if !ok {
+			i = len(risks)
+			seen[task.RoomID] = i
+			risks = append(risks, streakRisk{RoomID: task.RoomID, RoomTitle: task.RoomTitle, Days: days})
+		}
+		risks[i].Pending++
+	}
+
+	app.render(w, r, "dashboard.page.go.html", &templateData{
+		Tasks:      tasks,
+		Streaks:    risks,
+		Activities: activities,
+	})
+}
@@ -7,9 +7,14 @@ import (
 	"github.com/jumagaliev1/birgeDo/pkg/forms"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
+	if app.authenticatedUser(r) != nil {
+		app.dashboard(w, r)
+		return
+	}
 	app.render(w, r, "home.page.go.html", &templateData{})
 }
 
@@ -35,6 +40,13 @@ func (app *application) showRoom(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
+	for i := range tasks {
+		tasks[i].Items, err = app.models.Items.GetByTaskID(tasks[i].ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
 	usersTasks, err := app.models.Users.GetUserTask(room.ID)
 	if err == data.ErrRecordNotFound {
 		app.notFound(w)
@@ -43,6 +55,11 @@ func (app *application) showRoom(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
+	members, err := app.models.Users.GetMembersByRoom(room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	users, err := app.models.Users.GetAll()
 	if err == data.ErrRecordNotFound {
 		app.notFound(w)
@@ -53,12 +70,25 @@ func (app *application) showRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	var tpdata = make(map[string]data.UserTasks)
 	for _, ut := range usersTasks {
+		task := data.Task{
+			ID:         ut.TaskID,
+			Title:      ut.Task,
+			Kind:       ut.Kind,
+			Unit:       ut.Unit,
+			Target:     ut.Target,
+			Progress:   ut.Progress,
+			Done:       ut.Done,
+			ItemsDone:  ut.ItemsDone,
+			ItemsTotal: ut.ItemsTotal,
+			ProofID:    ut.ProofID,
+			Review:     ut.Review,
+		}
 		if tpdata[ut.User].Task == nil {
 			var dataTask []data.Task
-			dataTask = append(dataTask, data.Task{Title: ut.Task, Done: ut.Done})
+			dataTask = append(dataTask, task)
 			tpdata[ut.User] = data.UserTasks{UserID: ut.UserID, User: ut.User, Task: &dataTask}
 		} else {
-			*tpdata[ut.User].Task = append(*tpdata[ut.User].Task, data.Task{Title: ut.Task, Done: ut.Done})
+			*tpdata[ut.User].Task = append(*tpdata[ut.User].Task, task)
 
 		}
 	}
@@ -74,15 +104,34 @@ func (app *application) showRoom(w http.ResponseWriter, r *http.Request) {
 	//	userTask := UserTask{Task: tasks[i],
 	//		Done: }
 	//}
+	activities, err := app.models.Activity.GetForRoom(room.ID, 20)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	admin, err := app.models.Users.IsRoomAdmin(app.authenticatedUser(r).ID, room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	app.render(w, r, "showRoom.page.go.html", &templateData{
-		Room:     room,
-		Tasks:    tasks,
-		UserTask: userTasks,
-		Users:    users,
+		Room:       room,
+		RoomAdmin:  admin,
+		Tasks:      tasks,
+		UserTask:   userTasks,
+		Users:      users,
+		Members:    members,
+		Activities: activities,
 	})
 }
 
 func (app *application) createRoom(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	templates, err := app.models.Templates.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 	if r.Method == "POST" {
 		err := r.ParseForm()
 		if err != nil {
@@ -92,11 +141,20 @@ func (app *application) createRoom(w http.ResponseWriter, r *http.Request) {
 		form := forms.New(r.PostForm)
 		form.Required("title")
 		form.MaxLength("title", 50)
+		var template *data.RoomTemplate
+		if form.Get("template_id") != "" {
+			template, err = app.userTemplate(user, form.Get("template_id"))
+			if errors.Is(err, data.ErrRecordNotFound) {
+				form.Errors.Add("template_id", "This template does not exist")
+			} else if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
 		if !form.Valid() {
-			app.render(w, r, "createRoom.page.go.html", &templateData{Form: form})
+			app.render(w, r, "createRoom.page.go.html", &templateData{Form: form, Templates: templates})
 			return
 		}
-		user := app.authenticatedUser(r)
 		roomID, err := app.models.Room.Insert(&data.Room{Title: form.Get("title")})
 		if err != nil {
 			app.logger.PrintError(err, nil)
@@ -109,39 +167,115 @@ func (app *application) createRoom(w http.ResponseWriter, r *http.Request) {
 			app.serverError(w, err)
 			return
 		}
+		err = app.models.Users.SetRoomAdmin(user.ID, roomID, true)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if template != nil {
+			err = app.models.Room.Import(int64(roomID), template.Tasks, nil)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
 		app.session.Put(r, "flash", "Room successfully created!")
 		http.Redirect(w, r, fmt.Sprintf("/room/%d", roomID), http.StatusSeeOther)
 
 	} else {
-		app.render(w, r, "createRoom.page.go.html", &templateData{Form: forms.New(nil)})
+		app.render(w, r, "createRoom.page.go.html", &templateData{Form: forms.New(nil), Templates: templates})
 	}
 
 }
 
 func (app *application) createTask(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
 	err := r.ParseForm()
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
-	title := r.PostForm.Get("title")
 	roomID := r.PostForm.Get("room_id")
 	id, err := strconv.Atoi(roomID)
-	taskID, err := app.models.Task.Insert(&data.Task{Title: title, RoomID: int64(id)})
-	usersID, err := app.models.Users.GetUsersByRoom(id)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	ok, err := app.userInRoom(user.ID, int64(id))
 	if err != nil {
 		app.serverError(w, err)
 		return
+	} else if !ok {
+		app.clientError(w, http.StatusForbidden)
+		return
 	}
-	for _, uID := range usersID {
-		err = app.models.Users.InsertUserTask(uID, taskID)
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
+	form := forms.New(r.PostForm)
+	form.Required("title")
+	form.MaxLength("title", 50)
+	form.MaxLength("description", maxDescriptionLength)
+	form.PermittedValues("priority", "0", "1", "2", "3")
+	form.PermittedValues("kind", data.TaskKinds...)
+	form.MaxLength("unit", 20)
+	form.MatchesPattern("target", targetRX)
+	priority, _ := strconv.Atoi(form.Get("priority"))
+	task := &data.Task{Title: form.Get("title"), Description: form.Get("description"), RoomID: int64(id), Priority: priority}
+	readTarget(form.Values, task)
+	assignees, err := app.readAssignees(form, task)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !form.Valid() {
+		app.renderCreateTask(w, r, int64(id), form)
+		return
+	}
+	_, err = app.models.Task.Insert(task)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.models.Task.SetAssignees(task, assignees)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.recordActivity(task.RoomID, user.ID, task.ID, data.ActivityCreated)
+	err = app.models.Notifications.NotifyTaskAssignees(task.ID, user.ID, data.NotificationTaskAdded,
+		fmt.Sprintf("%s gave you a new task: %q", user.Name, task.Title))
+	if err != nil {
+		app.logger.PrintError(err, nil)
 	}
 	http.Redirect(w, r, fmt.Sprintf("/room/%d", id), http.StatusSeeOther)
 }
+
+// renderCreateTask shows the task form of a room again with the errors of a
+// rejected submission.
+func (app *application) renderCreateTask(w http.ResponseWriter, r *http.Request, roomID int64, form *forms.Form) {
+	room, err := app.models.Room.GetByID(roomID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	members, err := app.models.Users.GetMembersByRoom(room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	assignees := make(map[int]bool)
+	for _, value := range form.Values["assignee"] {
+		id, err := strconv.Atoi(value)
+		if err == nil {
+			assignees[id] = true
+		}
+	}
+	app.render(w, r, "createTask.page.go.html", &templateData{
+		Room:      room,
+		Members:   members,
+		Assignees: assignees,
+		Form:      form,
+	})
+}
+
 func (app *application) updateTask(w http.ResponseWriter, r *http.Request) {
 	user := app.authenticatedUser(r)
 	id, err := app.readIDParam(r)
@@ -150,7 +284,7 @@ func (app *application) updateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task, err := app.models.Users.GetUserTaskByBothID(user.ID, id)
+	userTask, err := app.models.Users.GetUserTaskByBothID(user.ID, id)
 	if err == data.ErrRecordNotFound {
 		app.notFound(w)
 		return
@@ -158,15 +292,61 @@ func (app *application) updateTask(w http.ResponseWriter, r *http.Request) {
 		app.serverError(w, err)
 		return
 	}
-	if task.Done == false {
+	task, err := app.models.Task.GetByID(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if task.Quantitative() {
+		amount := 1
+		if value := r.PostForm.Get("amount"); value != "" {
+			amount, err = strconv.Atoi(value)
+			if err != nil || amount == 0 {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+		}
+		// A single step never needs to be larger than the daily target.
+		amount = max(-task.Target, min(amount, task.Target))
+		var progress *data.Task
+		progress, err = app.models.Task.AddProgress(user.ID, id, amount)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		reached := progress.Progress >= progress.Target && !userTask.Done && progress.Review != data.ReviewPending
+		if reached && progress.RequiresProof && progress.ProofID == 0 {
+			app.session.Put(r, "flash", "Target reached, attach a photo to complete this task")
+		} else if reached {
+			err = app.taskCompleted(task, user)
+		}
+	} else if userTask.Done == false && userTask.Review != data.ReviewPending && task.RequiresProof {
+		app.session.Put(r, "flash", "Attach a photo to complete this task")
+		http.Redirect(w, r, fmt.Sprintf("/task/%d/view", task.ID), http.StatusSeeOther)
+		return
+	} else if userTask.Done == false && userTask.Review != data.ReviewPending {
 		err = app.models.Task.UpdateUserTaskByBothIDTrue(user.ID, int(id))
+		if err == nil {
+			err = app.taskCompleted(task, user)
+		}
 	} else {
-		err = app.models.Task.UpdateUserTaskByBothIDTrue(user.ID, int(id))
+		// Ticking a done or pending task again takes the completion back.
+		err = app.models.Task.UpdateUserTaskByBothIDFalse(user.ID, int(id))
 	}
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	// Quick-complete buttons on the dashboard send the user back there.
+	if r.PostForm.Get("from") == "home" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/mytasks", http.StatusSeeOther)
 
 }
@@ -188,7 +368,7 @@ func (app *application) signupUser(w http.ResponseWriter, r *http.Request) {
 	form := forms.New(r.PostForm)
 	form.Required("name", "email", "password")
 	form.MatchesPattern("email", forms.EmailRX)
-	form.MinLength("password", 10)
+	form.MinLength("password", minPasswordLength)
 
 	if !form.Valid() {
 		app.render(w, r, "signup.page.go.html", &templateData{Form: form})
@@ -238,10 +418,31 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 	form := forms.New(r.PostForm)
 	form.Required("email", "password")
+	ip := clientIP(r)
+	wait, err := app.loginAttempt(form.Get("email"), ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if wait > 0 {
+		form.Errors.Add("generic", retryMessage(wait))
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		app.render(w, r, "login.page.go.html", &templateData{
+			Form: form,
+		})
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(form.Get("email"))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.loginFailed(form.Get("email"), ip, nil)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
 			form.Errors.Add("generic", "Email or Password is incorrect")
 			app.render(w, r, "login.page.go.html", &templateData{
 				Form: form,
@@ -259,6 +460,11 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !match {
+		err = app.loginFailed(form.Get("email"), ip, user)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
 		form.Errors.Add("generic", "Email or Password is incorrect")
 		app.render(w, r, "login.page.go.html", &templateData{
 			Form: form,
@@ -266,12 +472,34 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 		//app.invalidCredentials(w)
 		return
 	}
+	app.loginPassed(ip)
+	app.completeLogin(w, r, user)
+}
+
+// completeLogin logs in a user whose first factor checked out, or sends
+// them on to the second step if they enabled two-factor authentication.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+	if !user.DeactivatedAt.IsZero() {
+		app.session.Put(r, "flash", "This account has been deactivated")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	if user.TOTPEnabled {
+		app.session.Put(r, "twoFactorUserID", user.ID)
+		app.session.Put(r, "twoFactorAt", time.Now())
+		app.session.Remove(r, "twoFactorAttempts")
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+	app.loginSucceeded(user.Email)
+	app.session.RenewToken(r)
 	app.session.Put(r, "userID", user.ID)
+	app.session.Put(r, "authenticatedAt", time.Now())
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
-	app.session.Remove(r, "userID")
+	app.session.Destroy(r)
 
 	app.session.Put(r, "flash", "You've been logged out successfully!")
 
@@ -304,8 +532,28 @@ func (app *application) showUserRooms(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) showUserTasks(w http.ResponseWriter, r *http.Request) {
 	user := app.authenticatedUser(r)
-	tasks, err := app.models.Users.GetTasksByUser(user.ID)
-	if len(tasks) == 0 {
+
+	form := forms.New(r.URL.Query())
+	form.PermittedValues("done", "done", "pending")
+	form.PermittedValues("group", "room", "tag", "done", "due")
+	form.MatchesPattern("due", dueTimeRX)
+	filters := data.TaskFilters{Tag: form.Get("tag")}
+	if form.Get("room") != "" {
+		roomID, err := strconv.ParseInt(form.Get("room"), 10, 64)
+		if err != nil || roomID < 1 {
+			form.Errors.Add("room", "This field is invalid")
+		}
+		filters.RoomID = roomID
+	}
+	if form.Valid() {
+		filters.Done = form.Get("done")
+		filters.DueBefore = form.Get("due")
+	} else {
+		filters = data.TaskFilters{}
+	}
+
+	tasks, err := app.models.Users.GetTasksByUser(user.ID, filters)
+	if len(tasks) == 0 && filters == (data.TaskFilters{}) {
 		//TO-DO fix this
 		app.session.Put(r, "flash", "No yet Tasks. You can create")
 	}
@@ -314,14 +562,39 @@ func (app *application) showUserTasks(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.session.Put(r, "flash", "No yet Tasks. You can create")
-			app.render(w, r, "myTasks.page.go.html", &templateData{})
+			app.render(w, r, "myTasks.page.go.html", &templateData{Form: form})
 		default:
 			app.serverError(w, err)
 		}
 		return
 	}
 
-	app.render(w, r, "myTasks.page.go.html", &templateData{Tasks: tasks})
+	items, err := app.models.Items.GetByUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	for i := range tasks {
+		tasks[i].Items = items[tasks[i].ID]
+	}
+	rooms, err := app.models.Users.GetRoomsByUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	tags, err := app.models.Tags.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "myTasks.page.go.html", &templateData{
+		Form:       form,
+		Rooms:      rooms,
+		Tags:       tags,
+		Tasks:      tasks,
+		TaskGroups: groupTasks(tasks, form.Get("group")),
+	})
 
 }
 
@@ -349,6 +622,14 @@ func (app *application) AddUser(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	room, err := app.models.Room.GetByID(int64(roomID))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.notify(userID, data.NotificationRoomAdded,
+		fmt.Sprintf("%s added you to the room %q", app.authenticatedUser(r).Name, room.Title),
+		fmt.Sprintf("/room/%d", room.ID))
 	http.Redirect(w, r, fmt.Sprintf("/room/%d", roomID), http.StatusSeeOther)
 }
 
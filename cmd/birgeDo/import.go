@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxImportSize = 1 << 20
+
+var dueTimeRX = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// roomImport is the parsed and validated content of an import document. It is
+// shown to the user as a dry-run preview before anything is written.
+type roomImport struct {
+	Tasks   []data.Task
+	Members []data.User
+}
+
+type importTask struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Schedule    string `json:"schedule"`
+	DueTime     string `json:"due_time"`
+}
+
+type importDocument struct {
+	Tasks   []importTask `json:"tasks"`
+	Members []string     `json:"members"`
+}
+
+// parseImportJSON reads documents of the form
+//
+//	{"tasks": [{"title": "...", "schedule": "daily", "due_time": "08:00"}], "members": ["a@b.kz"]}
+func parseImportJSON(r io.Reader) (*importDocument, error) {
+	var doc importDocument
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return &doc, nil
+}
+
+// parseImportCSV reads documents with a header row containing at least a
+// "type" column. Rows of type "task" use the title, description, schedule and
+// due_time columns, rows of type "member" use the email column.
+func parseImportCSV(r io.Reader) (*importDocument, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the document is empty")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["type"]; !ok {
+		return nil, errors.New(`the header row must contain a "type" column`)
+	}
+	get := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var doc importDocument
+	for n, record := range records[1:] {
+		switch strings.ToLower(get(record, "type")) {
+		case "task":
+			doc.Tasks = append(doc.Tasks, importTask{
+				Title:       get(record, "title"),
+				Description: get(record, "description"),
+				Schedule:    get(record, "schedule"),
+				DueTime:     get(record, "due_time"),
+			})
+		case "member":
+			doc.Members = append(doc.Members, get(record, "email"))
+		default:
+			return nil, fmt.Errorf("line %d: type must be task or member", n+2)
+		}
+	}
+	return &doc, nil
+}
+
+// validateImport checks every entry of the document and resolves member
+// emails to users. Problems are recorded against the "document" field of the
+// form, one message per entry.
+func (app *application) validateImport(form *forms.Form, doc *importDocument) (*roomImport, error) {
+	imp := &roomImport{}
+	seen := map[string]bool{}
+
+	for i, t := range doc.Tasks {
+		task := data.Task{
+			Title:       strings.TrimSpace(t.Title),
+			Description: t.Description,
+			Schedule:    strings.ToLower(t.Schedule),
+			DueTime:     t.DueTime,
+		}
+		if task.Schedule == "" {
+			task.Schedule = "daily"
+		}
+		switch {
+		case task.Title == "":
+			form.Errors.Add("document", fmt.Sprintf("task %d: title cannot be blank", i+1))
+		case utf8.RuneCountInString(task.Title) > 50:
+			form.Errors.Add("document", fmt.Sprintf("task %d: title is too long (maximum is 50 characters)", i+1))
+		}
+		if !permitted(task.Schedule, data.TaskSchedules...) {
+			form.Errors.Add("document", fmt.Sprintf("task %d: schedule must be one of %s", i+1, strings.Join(data.TaskSchedules, ", ")))
+		}
+		if utf8.RuneCountInString(task.Description) > maxDescriptionLength {
+			form.Errors.Add("document", fmt.Sprintf("task %d: description is too long (maximum is %d characters)", i+1, maxDescriptionLength))
+		}
+		if task.DueTime != "" && !dueTimeRX.MatchString(task.DueTime) {
+			form.Errors.Add("document", fmt.Sprintf("task %d: due time must look like 08:30", i+1))
+		}
+		imp.Tasks = append(imp.Tasks, task)
+	}
+
+	for i, email := range doc.Members {
+		email = strings.TrimSpace(email)
+		if email == "" || !forms.EmailRX.MatchString(email) {
+			form.Errors.Add("document", fmt.Sprintf("member %d: %q is not a valid email", i+1, email))
+			continue
+		}
+		if seen[strings.ToLower(email)] {
+			continue
+		}
+		seen[strings.ToLower(email)] = true
+
+		user, err := app.models.Users.GetByEmail(email)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				form.Errors.Add("document", fmt.Sprintf("member %d: no user with email %s", i+1, email))
+				continue
+			default:
+				return nil, err
+			}
+		}
+		imp.Members = append(imp.Members, *user)
+	}
+
+	if len(imp.Tasks) == 0 && len(imp.Members) == 0 {
+		form.Errors.Add("document", "the document does not contain any tasks or members")
+	}
+	return imp, nil
+}
+
+func permitted(value string, opts ...string) bool {
+	for _, opt := range opts {
+		if value == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *application) importRoomForm(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	room, err := app.models.Room.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, r, "importRoom.page.go.html", &templateData{Room: room, Form: forms.New(nil)})
+}
+
+func (app *application) importRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	room, err := app.models.Room.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err = r.ParseMultipartForm(maxImportSize)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	file, header, err := r.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, file)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		form.Set("document", buf.String())
+		if form.Get("format") == "" {
+			form.Set("format", strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), "."))
+		}
+	}
+	if form.Get("format") == "" && form.Get("document") != "" {
+		// A pasted document without a chosen format is JSON when it looks
+		// like it, CSV otherwise.
+		format := "csv"
+		document := strings.TrimSpace(form.Get("document"))
+		if strings.HasPrefix(document, "{") || strings.HasPrefix(document, "[") {
+			format = "json"
+		}
+		form.Set("format", format)
+	}
+	form.Required("format", "document")
+	form.PermittedValues("format", "csv", "json")
+	if !form.Valid() {
+		app.render(w, r, "importRoom.page.go.html", &templateData{Room: room, Form: form})
+		return
+	}
+
+	var doc *importDocument
+	if form.Get("format") == "json" {
+		doc, err = parseImportJSON(strings.NewReader(form.Get("document")))
+	} else {
+		doc, err = parseImportCSV(strings.NewReader(form.Get("document")))
+	}
+	if err != nil {
+		form.Errors.Add("document", err.Error())
+		app.render(w, r, "importRoom.page.go.html", &templateData{Room: room, Form: form})
+		return
+	}
+
+	imp, err := app.validateImport(form, doc)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !form.Valid() || form.Get("confirm") != "true" {
+		app.render(w, r, "importRoom.page.go.html", &templateData{Room: room, Form: form, Import: imp})
+		return
+	}
+
+	var userIDs []int
+	for _, member := range imp.Members {
+		userIDs = append(userIDs, member.ID)
+	}
+	err = app.models.Room.Import(room.ID, imp.Tasks, userIDs)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", fmt.Sprintf("Imported %d tasks and %d members", len(imp.Tasks), len(imp.Members)))
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+}
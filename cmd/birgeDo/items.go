@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/http"
+)
+
+func (app *application) createTaskItem(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	task, err := app.models.Task.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	ok, err := app.userInRoom(user.ID, task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	} else if !ok {
+		app.notFound(w)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("title")
+	form.MaxLength("title", 50)
+	if !form.Valid() {
+		app.session.Put(r, "flash", "Checklist item: "+form.Errors.Get("title"))
+		http.Redirect(w, r, fmt.Sprintf("/room/%d", task.RoomID), http.StatusSeeOther)
+		return
+	}
+	err = app.models.Items.Insert(&data.TaskItem{TaskID: task.ID, Title: form.Get("title")})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", task.RoomID), http.StatusSeeOther)
+}
+
+func (app *application) toggleTaskItem(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	taskID, completed, err := app.models.Items.Toggle(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	if completed {
+		task, err := app.models.Task.GetByID(taskID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		err = app.taskCompleted(task, user)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	http.Redirect(w, r, "/mytasks", http.StatusSeeOther)
+}
+
+func (app *application) deleteTaskItem(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	item, err := app.models.Items.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	task, err := app.models.Task.GetByID(item.TaskID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	ok, err := app.userInRoom(user.ID, task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	} else if !ok {
+		app.notFound(w)
+		return
+	}
+	completed, err := app.models.Items.Delete(item.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, err)
+		return
+	}
+	for _, userID := range completed {
+		member, err := app.models.Users.Get(userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		err = app.taskCompleted(task, member)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", task.RoomID), http.StatusSeeOther)
+}
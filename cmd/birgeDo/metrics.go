@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in milliseconds, of the request
+// latency histogram. Slower requests are counted under "inf".
+var latencyBuckets = []int64{5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+// The expvar variables are registered once, when the package loads, as
+// expvar panics on a second registration of the same name.
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	responsesByStatus               = expvar.NewMap("total_responses_sent_by_status")
+	requestLatency                  = expvar.NewMap("request_latency_ms")
+
+	// metricsDB is the pool whose statistics are published as "database".
+	metricsDB atomic.Pointer[sql.DB]
+)
+
+func init() {
+	expvar.Publish("database", expvar.Func(func() interface{} {
+		db := metricsDB.Load()
+		if db == nil {
+			return nil
+		}
+		return db.Stats()
+	}))
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("timestamp", expvar.Func(func() interface{} {
+		return time.Now().Unix()
+	}))
+}
+
+// publishMetrics adds the statistics of the application's connection pool
+// to the variables served by expvar.
+func (app *application) publishMetrics() {
+	metricsDB.Store(app.db)
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the original writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// metrics counts the requests and responses by status and records how long
+// they took, both in total and as a histogram.
+func metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		totalRequestsReceived.Add(1)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		totalResponsesSent.Add(1)
+		totalProcessingTimeMicroseconds.Add(duration.Microseconds())
+		responsesByStatus.Add(strconv.Itoa(rec.status), 1)
+
+		bucket := "inf"
+		for _, le := range latencyBuckets {
+			if duration.Milliseconds() <= le {
+				bucket = "le_" + strconv.FormatInt(le, 10)
+				break
+			}
+		}
+		requestLatency.Add(bucket, 1)
+	})
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"github.com/jumagaliev1/birgeDo/internal/data"
 	"github.com/justinas/nosurf"
+	"golang.org/x/time/rate"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -36,12 +40,90 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// rateLimit allows every client IP limiter.rps requests per second with
+// bursts of limiter.burst. Clients idle for three minutes are forgotten.
+// Static files and proof photos are not counted, a single page loads many
+// of them.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	if !app.config.limiter.enabled {
+		return next
+	}
+
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			mu.Lock()
+			for ip, c := range clients {
+				if time.Since(c.lastSeen) > 3*time.Minute {
+					delete(clients, ip)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && (strings.HasPrefix(r.URL.Path, "/static/") || strings.HasPrefix(r.URL.Path, "/proof/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		mu.Lock()
+		c, ok := clients[ip]
+		if !ok {
+			c = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+			clients[ip] = c
+		}
+		c.lastSeen = time.Now()
+		allowed := c.limiter.Allow()
+		mu.Unlock()
+		if !allowed {
+			app.clientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.authenticatedUser(r) == nil {
+		user := app.authenticatedUser(r)
+		if user == nil {
 			http.Redirect(w, r, "user/login", 302)
 			return
 		}
+		// An admin may require a new password, which has to be chosen
+		// before anything else.
+		if user.PasswordResetRequired && !strings.HasPrefix(r.URL.Path, "/user/settings") && r.URL.Path != "/user/logout" {
+			app.session.Put(r, "flash", "Please choose a new password to continue")
+			http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin only lets site admins through. It is used after
+// requireAuthenticatedUser, which handles anonymous visitors.
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.authenticatedUser(r)
+		if user == nil || !user.Admin {
+			app.notFound(w)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -74,6 +156,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			app.serverError(w, err)
 			return
 		}
+		if app.session.CreatedAt(r).Before(user.PasswordChangedAt) || !user.DeactivatedAt.IsZero() {
+			app.session.Destroy(r)
+			next.ServeHTTP(w, r)
+			return
+		}
 
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
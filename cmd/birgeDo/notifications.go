@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// reminderWindow is how long before its due time a pending task is reminded
+// of. Reminders are sent once per window.
+const reminderWindow = time.Hour
+
+// notify persists a notification for a user. Like the activity feed, a
+// failure is logged instead of failing the request that caused it.
+func (app *application) notify(userID int, kind, message, link string) {
+	err := app.models.Notifications.Insert(&data.Notification{UserID: userID, Kind: kind, Message: message, Link: link})
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"kind": kind})
+	}
+}
+
+// sendReminders notifies users about their pending tasks due soon.
+func (app *application) sendReminders() {
+	n, err := app.models.Notifications.SendReminders(reminderWindow)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if n > 0 {
+		app.logger.PrintInfo("Sent task reminders", map[string]string{"count": strconv.FormatInt(n, 10)})
+	}
+}
+
+func (app *application) showNotifications(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	notifications, err := app.models.Notifications.GetForUser(user.ID, 100)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, r, "notifications.page.go.html", &templateData{
+		Notifications: notifications,
+	})
+}
+
+// readNotification marks a notification as read and follows its link.
+func (app *application) readNotification(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	notification, err := app.models.Notifications.MarkRead(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	link := notification.Link
+	if link == "" {
+		link = "/notifications"
+	}
+	http.Redirect(w, r, link, http.StatusSeeOther)
+}
+
+func (app *application) readAllNotifications(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := app.models.Notifications.MarkAllRead(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/blob"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	maxProofSize   = 5 << 20
+	maxProofPixels = 40_000_000
+	thumbnailSize  = 160
+	thumbnailType  = "image/jpeg"
+	proofKeyPrefix = "proofs/"
+)
+
+// proofTypes maps the accepted image MIME types to the file extension they
+// are stored with.
+var proofTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// thumbnail scales img down so that its longer side is at most size pixels.
+// Smaller images keep their size.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		size = max(width, height)
+	}
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, bounds, draw.Src, nil)
+	return thumb
+}
+
+func randomKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readProof reads an uploaded image, checking its size and sniffing its MIME
+// type from the content instead of trusting the client. The dimensions are
+// checked before decoding, as a small file may declare a huge image.
+func readProof(r io.Reader) ([]byte, string, image.Image, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxProofSize+1))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(content) > maxProofSize {
+		return nil, "", nil, fmt.Errorf("The photo must not be larger than %d MB", maxProofSize>>20)
+	}
+	contentType := http.DetectContentType(content)
+	if _, ok := proofTypes[contentType]; !ok {
+		return nil, "", nil, errors.New("The photo must be a JPEG, PNG or GIF image")
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", nil, errors.New("The photo could not be read")
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxProofPixels {
+		return nil, "", nil, fmt.Errorf("The photo must not have more than %d megapixels", maxProofPixels/1_000_000)
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", nil, errors.New("The photo could not be read")
+	}
+	return content, contentType, img, nil
+}
+
+func (app *application) uploadProof(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	task, _, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	_, err := app.models.Users.GetUserTaskByBothID(user.ID, task.ID)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	redirect := fmt.Sprintf("/task/%d/view", task.ID)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxProofSize+(1<<20))
+	err = r.ParseMultipartForm(maxProofSize)
+	if err != nil {
+		app.session.Put(r, "flash", fmt.Sprintf("The photo must not be larger than %d MB", maxProofSize>>20))
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		app.session.Put(r, "flash", "Choose a photo to upload")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+	content, contentType, img, err := readProof(file)
+	if err != nil {
+		app.session.Put(r, "flash", err.Error())
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	var thumb bytes.Buffer
+	err = jpeg.Encode(&thumb, thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 80})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	key, err := randomKey()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	proof := &data.Proof{
+		TaskID:      task.ID,
+		UserID:      user.ID,
+		ImageKey:    proofKeyPrefix + key + proofTypes[contentType],
+		ThumbKey:    proofKeyPrefix + key + "_thumb.jpg",
+		ContentType: contentType,
+	}
+	err = app.blobs.Put(r.Context(), proof.ImageKey, bytes.NewReader(content))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.blobs.Put(r.Context(), proof.ThumbKey, &thumb)
+	if err != nil {
+		app.deleteBlobs([]string{proof.ImageKey})
+		app.serverError(w, err)
+		return
+	}
+	completed, err := app.models.Proofs.Insert(proof)
+	if err != nil {
+		app.deleteBlobs([]string{proof.ImageKey, proof.ThumbKey})
+		app.serverError(w, err)
+		return
+	}
+	if completed {
+		err = app.taskCompleted(task, user)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	app.session.Put(r, "flash", "Photo attached!")
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// showProof serves a proof photo, or its thumbnail when thumb is set, to the
+// members of the task's room.
+func (app *application) showProof(thumb bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.authenticatedUser(r)
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFound(w)
+			return
+		}
+		proof, err := app.models.Proofs.GetByID(id)
+		if err == data.ErrRecordNotFound {
+			app.notFound(w)
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		task, err := app.models.Task.GetByID(proof.TaskID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		ok, err := app.userInRoom(user.ID, task.RoomID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		} else if !ok {
+			app.notFound(w)
+			return
+		}
+
+		key, contentType := proof.ImageKey, proof.ContentType
+		if thumb {
+			key, contentType = proof.ThumbKey, thumbnailType
+		}
+		content, err := app.blobs.Get(r.Context(), key)
+		if errors.Is(err, blob.ErrNotFound) {
+			app.notFound(w)
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		io.Copy(w, content)
+	}
+}
+
+// setProofTasks stores which tasks of the room require a photo to be
+// completed. The body lists them as repeated "task" values.
+func (app *application) setProofTasks(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	admin, err := app.models.Users.IsRoomAdmin(app.authenticatedUser(r).ID, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !admin {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	var taskIDs []int64
+	for _, value := range r.PostForm["task"] {
+		taskID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || taskID < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	err = app.models.Task.SetRequiresProof(id, taskIDs)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Put(r, "flash", "Proof settings saved!")
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", id), http.StatusSeeOther)
+}
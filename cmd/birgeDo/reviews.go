@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"net/http"
+	"strconv"
+)
+
+// taskCompleted is called whenever a user finishes a task. In rooms with peer
+// verification the completion becomes pending and the other members are asked
+// to review it; elsewhere it is recorded in the activity feed right away.
+func (app *application) taskCompleted(task *data.Task, user *data.User) error {
+	room, err := app.models.Room.GetByID(task.RoomID)
+	if err != nil {
+		return err
+	}
+	if !room.Verification {
+		app.recordActivity(task.RoomID, user.ID, task.ID, data.ActivityCompleted)
+		return nil
+	}
+	err = app.models.Task.RequestReview(user.ID, task.ID)
+	if err != nil {
+		return err
+	}
+	err = app.models.Notifications.NotifyRoomMembers(room.ID, user.ID, data.NotificationReview,
+		fmt.Sprintf("%s completed %q and is waiting for approval", user.Name, task.Title),
+		fmt.Sprintf("/room/%d", room.ID))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+	return nil
+}
+
+func (app *application) reviewTask(w http.ResponseWriter, r *http.Request) {
+	reviewer := app.authenticatedUser(r)
+	task, room, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	userID, err := strconv.Atoi(r.PostForm.Get("user_id"))
+	if err != nil || userID < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	decision := r.PostForm.Get("decision")
+	if !permitted(decision, "approve", "reject") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	if userID == reviewer.ID {
+		app.session.Put(r, "flash", "You cannot review your own completion")
+		http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+		return
+	}
+
+	approve := decision == "approve"
+	err = app.models.Task.Review(userID, task.ID, reviewer.ID, approve)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.session.Put(r, "flash", "This completion is no longer waiting for review")
+			http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if approve {
+		app.recordActivity(task.RoomID, userID, task.ID, data.ActivityCompleted)
+		app.notify(userID, data.NotificationReview,
+			fmt.Sprintf("%s approved your completion of %q", reviewer.Name, task.Title),
+			fmt.Sprintf("/room/%d", room.ID))
+		app.session.Put(r, "flash", "Completion approved")
+	} else {
+		app.notify(userID, data.NotificationReview,
+			fmt.Sprintf("%s rejected your completion of %q", reviewer.Name, task.Title),
+			fmt.Sprintf("/task/%d/view", task.ID))
+		app.session.Put(r, "flash", "Completion rejected")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+}
+
+// setVerification turns peer verification of the room on or off. Only room
+// admins may change it.
+func (app *application) setVerification(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	admin, err := app.models.Users.IsRoomAdmin(user.ID, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !admin {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	on := r.PostForm.Get("verification") == "on"
+	err = app.models.Room.SetVerification(id, on)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if on {
+		app.session.Put(r, "flash", "Completions now need approval by another member")
+	} else {
+		app.session.Put(r, "flash", "Peer verification turned off")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", id), http.StatusSeeOther)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/http"
+	"strconv"
+)
+
+// userTemplate looks up a template that the user is allowed to use: either a
+// built-in one or one of their own.
+func (app *application) userTemplate(user *data.User, id string) (*data.RoomTemplate, error) {
+	templateID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || templateID < 1 {
+		return nil, data.ErrRecordNotFound
+	}
+	template, err := app.models.Templates.GetByID(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if !template.BuiltIn && template.UserID != int64(user.ID) {
+		return nil, data.ErrRecordNotFound
+	}
+	return template, nil
+}
+
+func (app *application) saveRoomTemplate(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	room, err := app.models.Room.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.MaxLength("title", 50)
+	if !form.Valid() {
+		app.session.Put(r, "flash", form.Errors.Get("title"))
+		http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+		return
+	}
+	title := form.Get("title")
+	if title == "" {
+		title = room.Title
+	}
+
+	tasks, err := app.models.Task.GetByRoomID(room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	for i := range tasks {
+		tasks[i].Items, err = app.models.Items.GetByTaskID(tasks[i].ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	err = app.models.Templates.Insert(&data.RoomTemplate{UserID: int64(user.ID), Title: title, Tasks: tasks})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Put(r, "flash", "Room saved as a template!")
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+}
+
+func (app *application) deleteRoomTemplate(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = app.models.Templates.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.session.Put(r, "flash", "Template deleted")
+	http.Redirect(w, r, "/room", http.StatusSeeOther)
+}
+
+func (app *application) cloneRoom(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	room, err := app.models.Room.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.MaxLength("title", 50)
+	if !form.Valid() {
+		app.session.Put(r, "flash", form.Errors.Get("title"))
+		http.Redirect(w, r, fmt.Sprintf("/room/%d", room.ID), http.StatusSeeOther)
+		return
+	}
+	title := form.Get("title")
+	if title == "" {
+		title = room.Title
+	}
+
+	cloneID, err := app.models.Room.Clone(room.ID, title, user.ID, form.Get("members") == "on")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Put(r, "flash", "Room successfully cloned!")
+	http.Redirect(w, r, fmt.Sprintf("/room/%d", cloneID), http.StatusSeeOther)
+}
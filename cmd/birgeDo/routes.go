@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"net/http"
@@ -8,18 +9,45 @@ import (
 
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
-	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	standardMiddleware := alice.New(metrics, app.recoverPanic, app.logRequest, secureHeaders, app.rateLimit)
 	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.authenticate)
 	router.Handler(http.MethodGet, "/", dynamicMiddleware.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/room", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createRoom))
 	router.Handler(http.MethodPost, "/room", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createRoom))
 	router.Handler(http.MethodGet, "/room/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.showRoom))
+	router.Handler(http.MethodGet, "/room/:id/import", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.importRoomForm))
+	router.Handler(http.MethodPost, "/room/:id/import", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.importRoom))
+	router.Handler(http.MethodPost, "/room/:id/template", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.saveRoomTemplate))
+	router.Handler(http.MethodPost, "/room/:id/clone", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.cloneRoom))
+	router.Handler(http.MethodPost, "/template/:id/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.deleteRoomTemplate))
+	router.Handler(http.MethodGet, "/room/:id/stats", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.showRoomStats))
+	router.Handler(http.MethodPost, "/room/:id/proof", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.setProofTasks))
+	router.Handler(http.MethodPost, "/room/:id/verification", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.setVerification))
+	router.Handler(http.MethodPost, "/room/:id/reorder", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAccessRoom).ThenFunc(app.reorderTasks))
 	router.Handler(http.MethodPost, "/task", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createTask))
-	router.Handler(http.MethodGet, "/task/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateTask))
+	router.Handler(http.MethodPost, "/task/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateTask))
+	router.Handler(http.MethodGet, "/task/:id/view", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showTask))
+	router.Handler(http.MethodPost, "/task/:id/edit", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.editTask))
+	router.Handler(http.MethodPost, "/task/:id/assignees", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.editTaskAssignees))
+	router.Handler(http.MethodPost, "/task/:id/tags", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.addTaskTag))
+	router.Handler(http.MethodPost, "/task/:id/tags/remove", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.removeTaskTag))
+	router.Handler(http.MethodPost, "/task/:id/comments", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createComment))
+	router.Handler(http.MethodPost, "/comment/:id/edit", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.editComment))
+	router.Handler(http.MethodPost, "/comment/:id/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.deleteComment))
+	router.Handler(http.MethodPost, "/task/:id/review", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.reviewTask))
+	router.Handler(http.MethodPost, "/task/:id/proof", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.uploadProof))
+	router.Handler(http.MethodGet, "/proof/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showProof(false)))
+	router.Handler(http.MethodGet, "/proof/:id/thumb", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showProof(true)))
+	router.Handler(http.MethodPost, "/task/:id/items", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createTaskItem))
+	router.Handler(http.MethodPost, "/item/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.toggleTaskItem))
+	router.Handler(http.MethodPost, "/item/:id/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.deleteTaskItem))
 	router.Handler(http.MethodPost, "/addUser", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.AddUser))
 	router.Handler(http.MethodPost, "/removeUser", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.RemoveUser))
 	router.Handler(http.MethodPost, "/removeTask", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.RemoveTask))
 
+	router.Handler(http.MethodGet, "/notifications", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showNotifications))
+	router.Handler(http.MethodPost, "/notifications/read", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.readAllNotifications))
+	router.Handler(http.MethodPost, "/notification/:id", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.readNotification))
 	router.Handler(http.MethodGet, "/myrooms", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showUserRooms))
 	router.Handler(http.MethodGet, "/mytasks", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showUserTasks))
 
@@ -28,6 +56,36 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/user/login", dynamicMiddleware.ThenFunc(app.loginUserForm))
 	router.Handler(http.MethodPost, "/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
 	router.Handler(http.MethodPost, "/user/logout", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.logoutUser))
+	router.Handler(http.MethodGet, "/user/login/sso/:provider", dynamicMiddleware.ThenFunc(app.ssoLogin))
+	router.Handler(http.MethodGet, "/user/login/sso/:provider/callback", dynamicMiddleware.ThenFunc(app.ssoCallback))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamicMiddleware.ThenFunc(app.loginTwoFactorForm))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamicMiddleware.ThenFunc(app.loginTwoFactor))
+	router.Handler(http.MethodGet, "/user/settings", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showSettings))
+	router.Handler(http.MethodPost, "/user/settings/profile", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateProfile))
+	router.Handler(http.MethodPost, "/user/settings/email", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.changeEmail))
+	router.Handler(http.MethodPost, "/user/settings/password", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.changePassword))
+	router.Handler(http.MethodPost, "/user/settings/notifications", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateNotificationSettings))
+	router.Handler(http.MethodGet, "/user/export", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.downloadUserData))
+	router.Handler(http.MethodPost, "/user/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.requestAccountDeletion))
+	router.Handler(http.MethodPost, "/user/delete/cancel", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.cancelAccountDeletion))
+	router.Handler(http.MethodGet, "/user/email/confirm", dynamicMiddleware.ThenFunc(app.confirmEmail))
+	router.Handler(http.MethodGet, "/user/sessions", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showSessions))
+	router.Handler(http.MethodPost, "/user/sessions/revoke", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.revokeSession))
+	router.Handler(http.MethodPost, "/user/sessions/revoke-all", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.revokeAllSessions))
+	router.Handler(http.MethodGet, "/user/security", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.showSecurity))
+	router.Handler(http.MethodPost, "/user/2fa/setup", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.setupTwoFactor))
+	router.Handler(http.MethodPost, "/user/2fa/enable", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.enableTwoFactor))
+	router.Handler(http.MethodPost, "/user/2fa/disable", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.disableTwoFactor))
+
+	router.Handler(http.MethodGet, "/admin", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).Then(http.RedirectHandler("/admin/users", http.StatusSeeOther)))
+	router.Handler(http.MethodGet, "/admin/metrics", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).Then(expvar.Handler()))
+	router.Handler(http.MethodGet, "/admin/users", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/:id/deactivate", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.deactivateUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/reactivate", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.reactivateUser))
+	router.Handler(http.MethodPost, "/admin/users/:id/reset-password", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.forcePasswordReset))
+	router.Handler(http.MethodPost, "/admin/users/:id/reset-2fa", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.resetTwoFactor))
+	router.Handler(http.MethodGet, "/admin/rooms", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.adminRooms))
+	router.Handler(http.MethodGet, "/admin/audit", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireAdmin).ThenFunc(app.adminAuditLog))
 
 	//router.Handler(http.MethodGet, "/static/", http.StripPrefix("/static", fileServer))
 	router.ServeFiles("/static/*filepath", http.Dir("ui/static"))
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/internal/session"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userSession is a row of the sessions page.
+type userSession struct {
+	ID       string
+	Device   string
+	IP       string
+	LastSeen time.Time
+	Current  bool
+}
+
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	platforms = []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeDevice turns a user agent into a short description such as
+// "Firefox on Linux". Unknown agents are shown shortened as they are.
+func describeDevice(userAgent string) string {
+	var browser, platform string
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	case userAgent == "":
+		return "Unknown device"
+	default:
+		return truncate(userAgent, 40)
+	}
+}
+
+func (app *application) deleteExpiredSessions() {
+	n, err := app.session.Store.DeleteExpired(context.Background())
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if n > 0 {
+		app.logger.PrintInfo("Deleted expired sessions", map[string]string{"count": strconv.FormatInt(n, 10)})
+	}
+}
+
+func (app *application) showSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	records, err := app.session.Store.FindByUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	current := app.session.ID(r)
+	var sessions []userSession
+	for _, record := range records {
+		// Sessions from before a password change are revoked on their next
+		// request, so they are not listed as active.
+		if record.CreatedAt.Before(user.PasswordChangedAt) {
+			continue
+		}
+		sessions = append(sessions, userSession{
+			ID:       record.ID,
+			Device:   describeDevice(record.UserAgent),
+			IP:       record.IP,
+			LastSeen: record.LastSeen,
+			Current:  record.ID == current,
+		})
+	}
+	app.render(w, r, "sessions.page.go.html", &templateData{
+		Sessions: sessions,
+	})
+}
+
+func (app *application) revokeSession(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	id := r.PostForm.Get("session")
+	if id == app.session.ID(r) {
+		app.session.Destroy(r)
+		app.session.Put(r, "flash", "You've been logged out successfully!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	err = app.session.Revoke(r.Context(), user.ID, id)
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditSessionsRevoked, "one session")
+	app.session.Put(r, "flash", "The session was logged out")
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+func (app *application) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := app.session.Store.DeleteByUser(r.Context(), user.ID, "")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditSessionsRevoked, "all sessions")
+	app.session.Destroy(r)
+	app.session.Put(r, "flash", "You've been logged out on all devices")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
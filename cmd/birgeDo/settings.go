@@ -0,0 +1,381 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxNameLength = 100
+
+// notificationLabels describes each notification kind on the settings page.
+var notificationLabels = map[string]string{
+	data.NotificationRoomAdded: "I'm added to a room",
+	data.NotificationTaskAdded: "A task is assigned to me",
+	data.NotificationReminder:  "A task of mine is due soon",
+	data.NotificationMention:   "Someone mentions me in a comment",
+	data.NotificationReview:    "A completion waits for my review",
+}
+
+type notificationSetting struct {
+	Kind  string
+	Label string
+	On    bool
+}
+
+// timeZones are suggested on the settings page. Any IANA zone is accepted.
+var timeZones = []string{
+	"UTC",
+	"Asia/Almaty",
+	"Asia/Aqtobe",
+	"Europe/Moscow",
+	"Europe/Istanbul",
+	"Europe/London",
+	"Europe/Berlin",
+	"America/New_York",
+	"America/Los_Angeles",
+}
+
+// settingsPage is what the settings page shows besides the form.
+type settingsPage struct {
+	Notifications []notificationSetting
+	TimeZones     []string
+	// OwnedRooms are the rooms affected by deleting the account.
+	OwnedRooms  []data.OwnedRoom
+	GracePeriod int // in days
+}
+
+// settingsForm returns the values of the settings forms: the user's current
+// settings overlaid with whatever was just posted.
+func settingsForm(user *data.User, posted url.Values) *forms.Form {
+	values := url.Values{}
+	values.Set("name", user.Name)
+	values.Set("email", user.Email)
+	values.Set("time_zone", user.TimeZone)
+	values.Set("version", strconv.Itoa(user.Version))
+	for key, value := range posted {
+		if strings.Contains(key, "password") || key == "csrf_token" {
+			continue
+		}
+		values[key] = value
+	}
+	return forms.New(values)
+}
+
+func (app *application) renderSettings(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	user := app.authenticatedUser(r)
+	rooms, err := app.models.Users.OwnedRooms(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	page := &settingsPage{
+		TimeZones:   timeZones,
+		OwnedRooms:  rooms,
+		GracePeriod: int(data.AccountDeletionGrace.Hours() / 24),
+	}
+	for _, kind := range data.NotificationKinds {
+		page.Notifications = append(page.Notifications, notificationSetting{
+			Kind:  kind,
+			Label: notificationLabels[kind],
+			On:    !slices.Contains(user.MutedNotifications, kind),
+		})
+	}
+	app.render(w, r, "settings.page.go.html", &templateData{
+		Form:     form,
+		Settings: page,
+	})
+}
+
+func (app *application) showSettings(w http.ResponseWriter, r *http.Request) {
+	app.renderSettings(w, r, settingsForm(app.authenticatedUser(r), nil))
+}
+
+// saveUser writes the user back, turning an edit conflict into a request to
+// review the settings again. It reports whether the caller may go on.
+func (app *application) saveUser(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	err := app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", "Your settings were changed elsewhere in the meantime. Please review them and try again.")
+			http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return false
+	}
+	return true
+}
+
+// postedVersion reads the version the form was rendered with, so edits
+// made from a stale page are reported as conflicts.
+func (app *application) postedVersion(w http.ResponseWriter, r *http.Request, form *forms.Form) (int, bool) {
+	version, err := strconv.Atoi(form.Get("version"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+func (app *application) updateProfile(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := settingsForm(user, r.PostForm)
+	version, ok := app.postedVersion(w, r, form)
+	if !ok {
+		return
+	}
+	form.Required("name", "time_zone")
+	form.MaxLength("name", maxNameLength)
+	if _, err := time.LoadLocation(form.Get("time_zone")); err != nil || form.Get("time_zone") == "Local" {
+		form.Errors.Add("time_zone", "Unknown time zone")
+	}
+	if !form.Valid() {
+		app.renderSettings(w, r, form)
+		return
+	}
+
+	user.Name = strings.TrimSpace(form.Get("name"))
+	user.TimeZone = form.Get("time_zone")
+	user.Version = version
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.session.Put(r, "flash", "Your profile was saved")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+func (app *application) updateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := settingsForm(user, r.PostForm)
+	version, ok := app.postedVersion(w, r, form)
+	if !ok {
+		return
+	}
+	muted := []string{}
+	for _, kind := range data.NotificationKinds {
+		if !slices.Contains(r.PostForm["notify"], kind) {
+			muted = append(muted, kind)
+		}
+	}
+	user.MutedNotifications = muted
+	user.Version = version
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	app.session.Put(r, "flash", "Your notification settings were saved")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// checkPassword adds an error to the field unless it holds the user's
+// current password.
+func (app *application) checkPassword(form *forms.Form, field string, user *data.User) error {
+	if !user.Password.IsSet() {
+		form.Errors.Add(field, "Choose a password first, your account does not have one yet")
+		return nil
+	}
+	if form.Get(field) == "" {
+		form.Errors.Add(field, "This field cannot be blank")
+		return nil
+	}
+	match, err := user.Password.Matches(form.Get(field))
+	if err != nil {
+		return err
+	}
+	if !match {
+		form.Errors.Add(field, "Password is incorrect")
+	}
+	return nil
+}
+
+// reauthWindow is how recently a user without a password must have signed
+// in to make the changes that otherwise ask for their password.
+const reauthWindow = 10 * time.Minute
+
+// confirmIdentity checks the password in field. Users who only sign in
+// through a provider have none, so for them the login itself must be recent.
+func (app *application) confirmIdentity(r *http.Request, form *forms.Form, field string, user *data.User) error {
+	if user.Password.IsSet() {
+		return app.checkPassword(form, field, user)
+	}
+	if time.Since(app.session.GetTime(r, "authenticatedAt")) > reauthWindow {
+		form.Errors.Add(field, fmt.Sprintf("Sign in again to confirm it is you, then try again within %d minutes", int(reauthWindow.Minutes())))
+	}
+	return nil
+}
+
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("new_password", "confirm_password")
+	form.MinLength("new_password", minPasswordLength)
+	if form.Get("new_password") != form.Get("confirm_password") {
+		form.Errors.Add("confirm_password", "Passwords do not match")
+	}
+	// A reset required by an admin follows a fresh login, as it logged the
+	// user out everywhere, so the current password is not asked again.
+	// Users who signed up with single sign-on have none to give.
+	if !user.PasswordResetRequired && user.Password.IsSet() {
+		err = app.checkPassword(form, "current_password", user)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	version, ok := app.postedVersion(w, r, form)
+	if !ok {
+		return
+	}
+	if !form.Valid() {
+		errs := form.Errors
+		form = settingsForm(user, r.PostForm)
+		form.Errors = errs
+		app.renderSettings(w, r, form)
+		return
+	}
+
+	err = user.Password.Set(form.Get("new_password"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	user.Version = version
+	if !app.saveUser(w, r, user) {
+		return
+	}
+	// The new password revokes every session started before it, so this
+	// one is renewed to stay logged in.
+	app.session.RenewToken(r)
+	app.audit(r, user.ID, user.ID, data.AuditPasswordChanged, "")
+	app.session.Put(r, "flash", "Your password was changed. Your other sessions were logged out.")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// changeEmail sends a confirmation link to the new address. The address is
+// only changed once the link is followed.
+func (app *application) changeEmail(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := settingsForm(user, r.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	err = app.checkPassword(form, "email_password", user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	email := strings.TrimSpace(form.Get("email"))
+	if form.Valid() {
+		if strings.EqualFold(email, user.Email) {
+			form.Errors.Add("email", "This is already your email address")
+		} else {
+			_, err := app.models.Users.GetByEmail(email)
+			switch {
+			case err == nil:
+				form.Errors.Add("email", "A user with this email address already exists")
+			case !errors.Is(err, data.ErrRecordNotFound):
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+	if !form.Valid() {
+		app.renderSettings(w, r, form)
+		return
+	}
+
+	change, err := app.models.EmailChanges.New(user.ID, email)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	link := fmt.Sprintf("%s/user/email/confirm?token=%s", strings.TrimRight(app.config.baseURL, "/"), change.Plaintext)
+	app.background(func() {
+		err := app.mailer.Send(email, "email_change.tmpl", map[string]interface{}{
+			"Name":  user.Name,
+			"Link":  link,
+			"Hours": int(data.EmailChangeTTL.Hours()),
+		})
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"email": email})
+		}
+	})
+	app.session.Put(r, "flash", fmt.Sprintf("We sent a confirmation link to %s", email))
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// confirmEmail completes an email change. The token in the link proves
+// access to the new address, so it works without being logged in.
+func (app *application) confirmEmail(w http.ResponseWriter, r *http.Request) {
+	change, err := app.models.EmailChanges.Take(r.URL.Query().Get("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.session.Put(r, "flash", "This confirmation link is invalid or has expired")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	user, err := app.models.Users.Get(change.UserID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	previous := user.Email
+	user.Email = change.Email
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			app.session.Put(r, "flash", "A user with this email address already exists")
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", "Your account was changed at the same time. Please request a new confirmation link.")
+		default:
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditEmailChanged, fmt.Sprintf("%s to %s", previous, user.Email))
+	app.background(func() {
+		err := app.mailer.Send(previous, "email_changed.tmpl", map[string]interface{}{
+			"Name":  user.Name,
+			"Email": user.Email,
+		})
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"email": previous})
+		}
+	})
+	app.session.Put(r, "flash", fmt.Sprintf("Your email address is now %s", user.Email))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/internal/sso"
+	"net/http"
+	"strings"
+)
+
+// newProviders discovers the single sign-on providers listed in the
+// providers file. A provider that cannot be reached is logged and left out,
+// so one broken issuer does not keep the site from starting.
+func (app *application) newProviders(path, baseURL string) ([]*sso.Provider, error) {
+	configs, err := sso.ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	var providers []*sso.Provider
+	for _, cfg := range configs {
+		redirectURL := fmt.Sprintf("%s/user/login/sso/%s/callback", strings.TrimRight(baseURL, "/"), cfg.Name)
+		provider, err := sso.NewProvider(cfg, redirectURL, nil)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"provider": cfg.Name, "issuer": cfg.Issuer})
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// provider returns the provider named in the URL, or nil.
+func (app *application) provider(r *http.Request) *sso.Provider {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+	for _, provider := range app.providers {
+		if provider.Name == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+func (app *application) ssoLogin(w http.ResponseWriter, r *http.Request) {
+	provider := app.provider(r)
+	if provider == nil {
+		app.notFound(w)
+		return
+	}
+	flow, err := sso.NewFlow()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.session.Put(r, "ssoProvider", provider.Name)
+	app.session.Put(r, "ssoState", flow.State)
+	app.session.Put(r, "ssoNonce", flow.Nonce)
+	app.session.Put(r, "ssoVerifier", flow.Verifier)
+	http.Redirect(w, r, provider.AuthCodeURL(flow), http.StatusFound)
+}
+
+// ssoCallback finishes the login the provider redirected back from. The
+// account is found by the verified email address of the identity, and
+// created if there is none yet.
+func (app *application) ssoCallback(w http.ResponseWriter, r *http.Request) {
+	provider := app.provider(r)
+	if provider == nil {
+		app.notFound(w)
+		return
+	}
+	flow := &sso.Flow{
+		State:    app.session.PopString(r, "ssoState"),
+		Nonce:    app.session.PopString(r, "ssoNonce"),
+		Verifier: app.session.PopString(r, "ssoVerifier"),
+	}
+	name := app.session.PopString(r, "ssoProvider")
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		app.session.Put(r, "flash", fmt.Sprintf("Login with %s was cancelled", provider.DisplayName))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	if name != provider.Name || flow.CheckState(query.Get("state")) != nil {
+		app.session.Put(r, "flash", "Your login has expired, please try again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), flow, query.Get("code"))
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"provider": provider.Name})
+		app.session.Put(r, "flash", fmt.Sprintf("Login with %s failed", provider.DisplayName))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+	email, ok := provider.VerifiedEmail(identity)
+	if !ok {
+		app.session.Put(r, "flash", fmt.Sprintf("Your %s account has no verified email address", provider.DisplayName))
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(email)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		user, err = app.createSSOUser(identity)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.logger.PrintInfo("Logged in with single sign-on", map[string]string{
+		"provider": provider.Name,
+		"email":    user.Email,
+	})
+	app.completeLogin(w, r, user)
+}
+
+// createSSOUser signs up the user of an identity. The account has no
+// password, so it can only log in through the provider until the user sets
+// one on the settings page.
+func (app *application) createSSOUser(identity *sso.Identity) (*data.User, error) {
+	name := identity.Name
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	user := &data.User{
+		Name:      name,
+		Email:     identity.Email,
+		Activated: true,
+	}
+	err := app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
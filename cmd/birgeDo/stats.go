@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// roomStats is the statistics page of a room with its charts already
+// rendered to SVG.
+type roomStats struct {
+	*data.RoomStats
+	MemberChart template.HTML
+	TaskChart   template.HTML
+	DailyChart  template.HTML
+}
+
+func (app *application) showRoomStats(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	room, err := app.models.Room.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	members, err := app.models.Users.GetMembersByRoom(room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	stats, err := app.models.Stats.GetRoomStats(room.ID, members)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var memberBars, taskBars, dailyBars []chartBar
+	for _, member := range stats.Members {
+		memberBars = append(memberBars, completionBar(member.User.Name, member.Month))
+	}
+	for _, task := range stats.Tasks {
+		taskBars = append(taskBars, completionBar(task.Title, task.Month))
+	}
+	today := time.Now()
+	for i, day := range stats.Daily {
+		date := today.AddDate(0, 0, i-len(stats.Daily)+1)
+		dailyBars = append(dailyBars, completionBar(date.Format("02 Jan"), day))
+	}
+
+	app.render(w, r, "stats.page.go.html", &templateData{
+		Room: room,
+		Stats: &roomStats{
+			RoomStats:   stats,
+			MemberChart: barChart(memberBars),
+			TaskChart:   barChart(taskBars),
+			DailyChart:  columnChart(dailyBars),
+		},
+	})
+}
+
+func completionBar(label string, c data.Completion) chartBar {
+	return chartBar{
+		Label:   label,
+		Percent: c.Percent(),
+		Caption: fmt.Sprintf("%d%% (%d/%d)", c.Percent(), c.Done, c.Total),
+	}
+}
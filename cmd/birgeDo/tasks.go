@@ -0,0 +1,408 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxDescriptionLength = 10000
+
+var targetRX = regexp.MustCompile(`^[1-9][0-9]{0,5}$`)
+
+// roomTask loads the task from the id parameter and makes sure the
+// authenticated user is a member of its room.
+func (app *application) roomTask(w http.ResponseWriter, r *http.Request) (*data.Task, *data.Room, bool) {
+	user := app.authenticatedUser(r)
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return nil, nil, false
+	}
+	task, err := app.models.Task.GetByID(id)
+	if err == data.ErrRecordNotFound {
+		app.notFound(w)
+		return nil, nil, false
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	}
+	ok, err := app.userInRoom(user.ID, task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	} else if !ok {
+		app.notFound(w)
+		return nil, nil, false
+	}
+	room, err := app.models.Room.GetByID(task.RoomID)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, nil, false
+	}
+	return task, room, true
+}
+
+// renderTask shows the task detail page with everything hanging off the
+// task: its checklist, the room members it can be assigned to, its duty
+// history and its comment thread.
+func (app *application) renderTask(w http.ResponseWriter, r *http.Request, task *data.Task, room *data.Room, form *forms.Form) {
+	var err error
+	task.Items, err = app.models.Items.GetByTaskID(task.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	members, assignees, err := app.taskAssignees(task)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	duties, err := app.models.Task.GetDuties(task.ID, 14)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	comments, err := app.models.Comments.GetByTaskID(task.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	admin, err := app.models.Users.IsRoomAdmin(app.authenticatedUser(r).ID, room.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, r, "task.page.go.html", &templateData{
+		Task:      task,
+		Room:      room,
+		RoomAdmin: admin,
+		Form:      form,
+		Members:   members,
+		Assignees: assignees,
+		Duties:    duties,
+		Comments:  comments,
+	})
+}
+
+func (app *application) showTask(w http.ResponseWriter, r *http.Request) {
+	task, room, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	app.renderTask(w, r, task, room, taskForm(task))
+}
+
+// taskForm returns the edit form of a task filled in with its values.
+func taskForm(task *data.Task) *forms.Form {
+	form := forms.New(nil)
+	form.Set("title", task.Title)
+	form.Set("description", task.Description)
+	form.Set("priority", strconv.Itoa(task.Priority))
+	form.Set("schedule", task.Schedule)
+	form.Set("due_time", task.DueTime)
+	form.Set("kind", task.Kind)
+	form.Set("unit", task.Unit)
+	form.Set("target", strconv.Itoa(task.Target))
+	return form
+}
+
+func (app *application) editTask(w http.ResponseWriter, r *http.Request) {
+	task, room, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("title")
+	form.MaxLength("title", 50)
+	form.MaxLength("description", maxDescriptionLength)
+	form.PermittedValues("priority", "0", "1", "2", "3")
+	form.PermittedValues("schedule", data.TaskSchedules...)
+	form.MatchesPattern("due_time", dueTimeRX)
+	form.PermittedValues("kind", data.TaskKinds...)
+	form.MaxLength("unit", 20)
+	form.MatchesPattern("target", targetRX)
+	if !form.Valid() {
+		app.renderTask(w, r, task, room, form)
+		return
+	}
+
+	task.Title = form.Get("title")
+	task.Description = form.Get("description")
+	task.Priority, _ = strconv.Atoi(form.Get("priority"))
+	if form.Get("schedule") != "" {
+		task.Schedule = form.Get("schedule")
+	}
+	task.DueTime = form.Get("due_time")
+	readTarget(form.Values, task)
+	err = app.models.Task.Update(task)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.session.Put(r, "flash", "The task was changed by someone else, please try again")
+		default:
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		app.session.Put(r, "flash", "Task updated!")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/task/%d/view", task.ID), http.StatusSeeOther)
+}
+
+// taskGroup is a titled section of the task list on /mytasks.
+type taskGroup struct {
+	Name  string
+	Tasks []data.Task
+}
+
+// groupTasks splits tasks into sections by room, tag, done state or due
+// time. Without a known grouping all tasks end up in a single unnamed group.
+// Tasks with several tags appear once under each of them.
+func groupTasks(tasks []data.Task, by string) []taskGroup {
+	var keys []string
+	groups := map[string][]data.Task{}
+	add := func(key string, task data.Task) {
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], task)
+	}
+
+	for _, task := range tasks {
+		switch by {
+		case "room":
+			add(task.RoomTitle, task)
+		case "tag":
+			if len(task.Tags) == 0 {
+				add("Untagged", task)
+			}
+			for _, tag := range task.Tags {
+				add("#"+tag, task)
+			}
+		case "done":
+			if task.Done {
+				add("Done", task)
+			} else {
+				add("Pending", task)
+			}
+		case "due":
+			if task.DueTime == "" {
+				add("No due time", task)
+			} else {
+				add("Due by "+task.DueTime, task)
+			}
+		default:
+			add("", task)
+		}
+	}
+
+	switch by {
+	case "tag", "due":
+		sort.Strings(keys)
+	case "done":
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+	var result []taskGroup
+	for _, key := range keys {
+		result = append(result, taskGroup{Name: key, Tasks: groups[key]})
+	}
+	return result
+}
+
+func (app *application) addTaskTag(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	task, _, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Set("name", strings.ToLower(strings.TrimPrefix(strings.TrimSpace(form.Get("name")), "#")))
+	form.Required("name")
+	form.MaxLength("name", 30)
+	if !form.Valid() {
+		app.session.Put(r, "flash", "Tag: "+form.Errors.Get("name"))
+		http.Redirect(w, r, "/mytasks", http.StatusSeeOther)
+		return
+	}
+	err = app.models.Tags.AddToTask(user.ID, task.ID, form.Get("name"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/mytasks", http.StatusSeeOther)
+}
+
+func (app *application) removeTaskTag(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	task, _, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	err = app.models.Tags.RemoveFromTask(user.ID, task.ID, r.PostForm.Get("name"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/mytasks", http.StatusSeeOther)
+}
+
+// reorderTasks stores a new manual order for the tasks of a room. The body
+// lists the task IDs in their new order as repeated "task" values.
+func (app *application) reorderTasks(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	var taskIDs []int64
+	for _, value := range r.PostForm["task"] {
+		taskID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || taskID < 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	err = app.models.Task.Reorder(id, taskIDs)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readAssignees reads the assignment mode, rotation policy and chosen members
+// from a task form into task. Unless the task goes to everyone, the chosen
+// members must be members of the task's room and there must be at least
+// one; otherwise an error is added to the form's assignee field.
+func (app *application) readAssignees(form *forms.Form, task *data.Task) ([]int, error) {
+	task.Assignment = form.Get("assignment")
+	if !permitted(task.Assignment, data.TaskAssignments...) {
+		task.Assignment = "all"
+	}
+	task.Rotation = form.Get("rotation_policy")
+	if !permitted(task.Rotation, data.RotationPolicies...) {
+		task.Rotation = "round-robin"
+	}
+	if task.Assignment == "all" {
+		return nil, nil
+	}
+
+	members, err := app.models.Users.GetMembersByRoom(task.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[int]bool)
+	for _, member := range members {
+		isMember[member.ID] = true
+	}
+	var assignees []int
+	for _, value := range form.Values["assignee"] {
+		id, err := strconv.Atoi(value)
+		if err != nil || !isMember[id] {
+			form.Errors.Add("assignee", "Only members of the room can be assigned")
+			return nil, nil
+		}
+		assignees = append(assignees, id)
+	}
+	if len(assignees) == 0 {
+		form.Errors.Add("assignee", "Choose at least one member for the task")
+	}
+	return assignees, nil
+}
+
+// readTarget reads the kind, unit and daily target of a task from a task
+// form into task. Invalid targets fall back to one.
+func readTarget(values url.Values, task *data.Task) {
+	task.Kind = values.Get("kind")
+	task.Unit = strings.TrimSpace(values.Get("unit"))
+	task.Target, _ = strconv.Atoi(values.Get("target"))
+	if utf8.RuneCountInString(task.Unit) > 20 {
+		task.Unit = string([]rune(task.Unit)[:20])
+	}
+	if task.Target < 1 {
+		task.Target = 1
+	}
+}
+
+// taskAssignees returns the members of the task's room and the set of them
+// the task is currently limited to.
+func (app *application) taskAssignees(task *data.Task) ([]data.User, map[int]bool, error) {
+	members, err := app.models.Users.GetMembersByRoom(task.RoomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids, err := app.models.Task.GetAssignees(task.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	assignees := make(map[int]bool)
+	for _, id := range ids {
+		assignees[id] = true
+	}
+	return members, assignees, nil
+}
+
+func (app *application) editTaskAssignees(w http.ResponseWriter, r *http.Request) {
+	task, room, ok := app.roomTask(w, r)
+	if !ok {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	posted := forms.New(r.PostForm)
+	assignees, err := app.readAssignees(posted, task)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if posted.Valid() {
+		err = app.models.Task.SetAssignees(task, assignees)
+		if errors.Is(err, data.ErrNoAssignees) {
+			posted.Errors.Add("assignee", "Choose at least one member for the task")
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+	if !posted.Valid() {
+		form := taskForm(task)
+		form.Errors = posted.Errors
+		app.renderTask(w, r, task, room, form)
+		return
+	}
+	app.session.Put(r, "flash", "Assignees updated!")
+	http.Redirect(w, r, fmt.Sprintf("/task/%d/view", task.ID), http.StatusSeeOther)
+}
@@ -1,28 +1,60 @@
 package main
 
 import (
+	"bytes"
 	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/internal/sso"
 	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
 	"html/template"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
 type templateData struct {
-	AuthenticatedUser *data.User
-	CSRFToken         string
-	CurrentYear       int
-	Flash             string
-	Form              *forms.Form
-	Room              *data.Room
-	Rooms             []data.Room
-	Task              *data.Task
-	Tasks             []data.Task
-	UserTask          []data.UserTasks
-	Users             []data.User
+	Activities          []data.Activity
+	Admin               *adminPage
+	Assignees           map[int]bool
+	AuthenticatedUser   *data.User
+	Comments            []data.Comment
+	CSRFToken           string
+	CurrentYear         int
+	Duties              []data.Duty
+	Flash               string
+	Form                *forms.Form
+	Import              *roomImport
+	Members             []data.User
+	Notifications       []data.Notification
+	Providers           []*sso.Provider
+	Room                *data.Room
+	RoomAdmin           bool
+	Rooms               []data.Room
+	Sessions            []userSession
+	Settings            *settingsPage
+	Stats               *roomStats
+	Streaks             []streakRisk
+	Task                *data.Task
+	Tags                []data.Tag
+	Tasks               []data.Task
+	TaskGroups          []taskGroup
+	TwoFactor           *twoFactor
+	Templates           []data.RoomTemplate
+	UnreadNotifications int
+	UserTask            []data.UserTasks
+	Users               []data.User
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
+	return parseTemplates(dir, functions)
+}
+
+// parseTemplates parses every page with the given functions. The functions
+// have to be known before parsing, a template set cannot be cloned to swap
+// them once it has executed.
+func parseTemplates(dir string, funcs template.FuncMap) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 	pages, err := filepath.Glob(filepath.Join(dir, "*.page.go.html"))
 	if err != nil {
@@ -32,7 +64,7 @@ func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	for _, page := range pages {
 		name := filepath.Base(page)
 
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+		ts, err := template.New(name).Funcs(funcs).ParseFiles(page)
 		if err != nil {
 			return nil, err
 		}
@@ -49,13 +81,79 @@ func newTemplateCache(dir string) (map[string]*template.Template, error) {
 	}
 	return cache, nil
 }
+
+// zoneTemplates keeps a template cache for every time zone users chose, in
+// which humanDate shows times in that zone. The caches are parsed the first
+// time a zone is needed.
+type zoneTemplates struct {
+	dir    string
+	mu     sync.Mutex
+	caches map[string]map[string]*template.Template
+}
+
+func newZoneTemplates(dir string) *zoneTemplates {
+	return &zoneTemplates{dir: dir, caches: make(map[string]map[string]*template.Template)}
+}
+
+func (z *zoneTemplates) get(loc *time.Location) (map[string]*template.Template, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	cache, ok := z.caches[loc.String()]
+	if ok {
+		return cache, nil
+	}
+	funcs := template.FuncMap{}
+	for name, fn := range functions {
+		funcs[name] = fn
+	}
+	funcs["humanDate"] = humanDateIn(loc)
+	cache, err := parseTemplates(z.dir, funcs)
+	if err != nil {
+		return nil, err
+	}
+	z.caches[loc.String()] = cache
+	return cache, nil
+}
+
 func humanDate(t time.Time) string {
-	if t.IsZero() {
-		return ""
+	return humanDateIn(time.UTC)(t)
+}
+
+// humanDateIn returns a humanDate that shows times in the given location,
+// used for users who chose a time zone.
+func humanDateIn(loc *time.Location) func(time.Time) string {
+	return func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.In(loc).Format("02 Jan 2006 at 15:04")
 	}
-	return t.UTC().Format("02 Jan 2006 at 15:04")
+}
+
+var (
+	markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	markdownPolicy   = bluemonday.UGCPolicy()
+)
+
+// markdown renders user written Markdown to HTML. The output is passed
+// through a sanitizer, so raw HTML in the source cannot inject scripts.
+func markdown(source string) template.HTML {
+	var buf bytes.Buffer
+	err := markdownRenderer.Convert([]byte(source), &buf)
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(source))
+	}
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes()))
+}
+
+// inc turns a zero based index into a position for display.
+func inc(i int) int {
+	return i + 1
 }
 
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"inc":       inc,
+	"markdown":  markdown,
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginFailureWindow is how long a failed login counts towards delays and
+// lockouts.
+const loginFailureWindow = 15 * time.Minute
+
+// loginPolicy throttles the logins of one kind of key. After free failures
+// every further attempt has to wait a delay that doubles from one second up
+// to maxDelay, and lockAfter failures lock the key for lockFor.
+type loginPolicy struct {
+	free      int
+	maxDelay  time.Duration
+	lockAfter int
+	lockFor   time.Duration
+}
+
+var (
+	accountPolicy = loginPolicy{free: 2, maxDelay: 30 * time.Second, lockAfter: 5, lockFor: 15 * time.Minute}
+	// IP addresses get more room, as several users may share one.
+	ipPolicy = loginPolicy{free: 5, maxDelay: 30 * time.Second, lockAfter: 20, lockFor: 15 * time.Minute}
+)
+
+func (p loginPolicy) delay(failures int) time.Duration {
+	if failures <= p.free {
+		return 0
+	}
+	shift := failures - p.free - 1
+	if shift > 16 {
+		return p.maxDelay
+	}
+	return min(time.Second<<shift, p.maxDelay)
+}
+
+// wait returns how long until the throttle allows the next attempt.
+func (p loginPolicy) wait(t *data.LoginThrottle, now time.Time) time.Duration {
+	if t.Locked(now) {
+		return t.LockedUntil.Sub(now)
+	}
+	next := t.LastFailure.Add(p.delay(t.Failures))
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginAttempt claims a login attempt for email from ip and returns how long
+// it has to wait instead, if it is throttled. It runs before the password or
+// code is checked, so throttled attempts cost no bcrypt work. An allowed
+// attempt counts as a failure until loginPassed takes it back.
+func (app *application) loginAttempt(email, ip string) (time.Duration, error) {
+	wait, err := app.models.LoginThrottles.Attempt(ipKey(ip), loginFailureWindow, ipPolicy.wait)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	wait, err = app.models.LoginThrottles.Attempt(accountKey(email), loginFailureWindow, accountPolicy.wait)
+	if err != nil || wait > 0 {
+		refundErr := app.models.LoginThrottles.Refund(ipKey(ip))
+		if refundErr != nil {
+			app.logger.PrintError(refundErr, nil)
+		}
+		return wait, err
+	}
+	return 0, nil
+}
+
+// loginFailed locks the account and the IP address once a failed attempt,
+// already counted by loginAttempt, reaches their limit. The user is nil
+// when no account has the email. Lockouts are logged, and the owner of a
+// locked account gets an email about it.
+func (app *application) loginFailed(email, ip string, user *data.User) error {
+	account, locked, err := app.models.LoginThrottles.Lock(accountKey(email), accountPolicy.lockAfter, accountPolicy.lockFor)
+	if err != nil {
+		return err
+	}
+	if locked {
+		app.logger.PrintInfo("Locked account after failed logins", map[string]string{
+			"email":    email,
+			"ip":       ip,
+			"failures": strconv.Itoa(account.Failures),
+			"until":    account.LockedUntil.Format(time.RFC3339),
+		})
+		if user != nil {
+			app.background(func() {
+				err := app.mailer.Send(user.Email, "account_locked.tmpl", map[string]interface{}{
+					"Name":     user.Name,
+					"Failures": account.Failures,
+					"IP":       ip,
+					"Until":    humanDate(account.LockedUntil) + " UTC",
+				})
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"email": user.Email})
+				}
+			})
+		}
+	}
+
+	address, locked, err := app.models.LoginThrottles.Lock(ipKey(ip), ipPolicy.lockAfter, ipPolicy.lockFor)
+	if err != nil {
+		return err
+	}
+	if locked {
+		app.logger.PrintInfo("Locked IP address after failed logins", map[string]string{
+			"ip":       ip,
+			"failures": strconv.Itoa(address.Failures),
+			"until":    address.LockedUntil.Format(time.RFC3339),
+		})
+	}
+	return nil
+}
+
+// loginPassed takes back the failure loginAttempt counted for the IP address
+// when the password or code turned out to be right. The account keeps its
+// count until the whole login succeeded.
+func (app *application) loginPassed(ip string) {
+	err := app.models.LoginThrottles.Refund(ipKey(ip))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// loginSucceeded forgets the failures of the account. Those of the IP address
+// are kept, so one valid account does not reset a guessing run on others.
+func (app *application) loginSucceeded(email string) {
+	err := app.models.LoginThrottles.Reset(accountKey(email))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+func (app *application) deleteStaleLoginThrottles() {
+	_, err := app.models.LoginThrottles.DeleteStale(loginFailureWindow)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// retryMessage tells the user how long to wait, rounded up to whole seconds.
+func retryMessage(wait time.Duration) string {
+	wait = wait.Truncate(time.Second) + time.Second
+	return fmt.Sprintf("Too many failed login attempts. Try again in %s", wait)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jumagaliev1/birgeDo/internal/data"
+	"github.com/jumagaliev1/birgeDo/internal/totp"
+	"github.com/jumagaliev1/birgeDo/pkg/forms"
+	"html/template"
+	"net/http"
+	"rsc.io/qr"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer = "BirgeDo"
+	// twoFactorTimeout is how long a user has to enter their code after the
+	// password step of the login.
+	twoFactorTimeout     = 5 * time.Minute
+	twoFactorMaxAttempts = 5
+)
+
+// twoFactor is shown on the security page: the enrollment QR code while
+// two-factor authentication is being set up, and the recovery codes once
+// right after it has been enabled.
+type twoFactor struct {
+	QRCode        template.HTML
+	Secret        string
+	RecoveryCodes []string
+	Remaining     int
+}
+
+// qrSVG renders text as a QR code in SVG, so the secret never leaves the
+// server to be drawn by a third party.
+func qrSVG(text string) (template.HTML, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	const quiet = 4
+	size := code.Size + 2*quiet
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="200" height="200" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return template.HTML(b.String()), nil
+}
+
+func (app *application) enrollment(user *data.User, secret string) (*twoFactor, error) {
+	code, err := qrSVG(totp.URL(totpIssuer, user.Email, secret))
+	if err != nil {
+		return nil, err
+	}
+	return &twoFactor{QRCode: code, Secret: secret}, nil
+}
+
+func (app *application) showSecurity(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	setup := &twoFactor{}
+	if user.TOTPEnabled {
+		remaining, err := app.models.TwoFactor.CountRecoveryCodes(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		setup.Remaining = remaining
+	}
+	app.render(w, r, "security.page.go.html", &templateData{
+		Form:      forms.New(nil),
+		TwoFactor: setup,
+	})
+}
+
+// setupTwoFactor starts the enrollment with a new secret. It only becomes
+// active once enableTwoFactor has seen a valid code for it.
+func (app *application) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	if user.TOTPEnabled {
+		app.session.Put(r, "flash", "Two-factor authentication is already enabled")
+		http.Redirect(w, r, "/user/security", http.StatusSeeOther)
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.models.TwoFactor.SetSecret(user.ID, secret)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	setup, err := app.enrollment(user, secret)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, r, "security.page.go.html", &templateData{
+		Form:      forms.New(nil),
+		TwoFactor: setup,
+	})
+}
+
+func (app *application) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	secret, err := app.models.TwoFactor.GetSecret(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if user.TOTPEnabled || secret == "" {
+		http.Redirect(w, r, "/user/security", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	step, ok := totp.Validate(secret, form.Get("code"), time.Now())
+	if form.Valid() && !ok {
+		form.Errors.Add("code", "The code is not valid, check the clock of your device")
+	}
+	if !form.Valid() {
+		setup, err := app.enrollment(user, secret)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.render(w, r, "security.page.go.html", &templateData{
+			Form:      form,
+			TwoFactor: setup,
+		})
+		return
+	}
+
+	codes, err := data.GenerateRecoveryCodes(data.RecoveryCodeCount)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	err = app.models.TwoFactor.Enable(user.ID, step, codes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			http.Redirect(w, r, "/user/security", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	user.TOTPEnabled = true
+	app.audit(r, user.ID, user.ID, data.AuditTwoFactorEnabled, "")
+	app.session.Put(r, "flash", "Two-factor authentication is enabled")
+	app.render(w, r, "security.page.go.html", &templateData{
+		Form:      forms.New(nil),
+		TwoFactor: &twoFactor{RecoveryCodes: codes, Remaining: len(codes)},
+	})
+}
+
+func (app *application) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	err = app.confirmIdentity(r, form, "password", user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !form.Valid() {
+		remaining, err := app.models.TwoFactor.CountRecoveryCodes(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.render(w, r, "security.page.go.html", &templateData{
+			Form:      form,
+			TwoFactor: &twoFactor{Remaining: remaining},
+		})
+		return
+	}
+	err = app.models.TwoFactor.Disable(user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.audit(r, user.ID, user.ID, data.AuditTwoFactorDisabled, "")
+	app.session.Put(r, "flash", "Two-factor authentication is disabled")
+	http.Redirect(w, r, "/user/security", http.StatusSeeOther)
+}
+
+// pendingLogin returns the user who passed the password step of the login
+// and still has to enter a second factor.
+func (app *application) pendingLogin(r *http.Request) (*data.User, error) {
+	if !app.session.Exists(r, "twoFactorUserID") {
+		return nil, data.ErrRecordNotFound
+	}
+	if time.Since(app.session.GetTime(r, "twoFactorAt")) > twoFactorTimeout {
+		app.clearPendingLogin(r)
+		return nil, data.ErrRecordNotFound
+	}
+	user, err := app.models.Users.Get(app.session.GetInt(r, "twoFactorUserID"))
+	if errors.Is(err, data.ErrRecordNotFound) {
+		app.clearPendingLogin(r)
+	}
+	return user, err
+}
+
+func (app *application) clearPendingLogin(r *http.Request) {
+	app.session.Remove(r, "twoFactorUserID")
+	app.session.Remove(r, "twoFactorAt")
+	app.session.Remove(r, "twoFactorAttempts")
+}
+
+func (app *application) loginTwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	_, err := app.pendingLogin(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	app.render(w, r, "loginTwoFactor.page.go.html", &templateData{
+		Form: forms.New(nil),
+	})
+}
+
+// loginTwoFactor is the second step of the login. It accepts a code from the
+// authenticator app or an unused recovery code, and only then puts userID in
+// the session.
+func (app *application) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := app.pendingLogin(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.session.Put(r, "flash", "Your login has expired, please log in again")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if !form.Valid() {
+		app.render(w, r, "loginTwoFactor.page.go.html", &templateData{Form: form})
+		return
+	}
+	ip := clientIP(r)
+	wait, err := app.loginAttempt(user.Email, ip)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if wait > 0 {
+		form.Errors.Add("generic", retryMessage(wait))
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		app.render(w, r, "loginTwoFactor.page.go.html", &templateData{Form: form})
+		return
+	}
+
+	code := strings.TrimSpace(form.Get("code"))
+	recovery := len(strings.ReplaceAll(code, " ", "")) != totp.Digits
+	var ok bool
+	if recovery {
+		ok, err = app.models.TwoFactor.UseRecoveryCode(user.ID, code)
+	} else {
+		var secret string
+		secret, err = app.models.TwoFactor.GetSecret(user.ID)
+		if err == nil {
+			if step, valid := totp.Validate(secret, code, time.Now()); valid {
+				ok, err = app.models.TwoFactor.UseStep(user.ID, step)
+			}
+		}
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if !ok {
+		err = app.loginFailed(user.Email, ip, user)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		attempts := app.session.GetInt(r, "twoFactorAttempts") + 1
+		if attempts >= twoFactorMaxAttempts {
+			app.clearPendingLogin(r)
+			app.session.Put(r, "flash", "Too many invalid codes, please log in again")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.session.Put(r, "twoFactorAttempts", attempts)
+		form.Errors.Add("generic", "The code is not valid")
+		app.render(w, r, "loginTwoFactor.page.go.html", &templateData{Form: form})
+		return
+	}
+
+	app.clearPendingLogin(r)
+	app.loginPassed(ip)
+	app.loginSucceeded(user.Email)
+	app.session.RenewToken(r)
+	app.session.Put(r, "userID", user.ID)
+	app.session.Put(r, "authenticatedAt", time.Now())
+	if recovery {
+		remaining, err := app.models.TwoFactor.CountRecoveryCodes(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.session.Put(r, "flash", fmt.Sprintf("You used a recovery code, %d left", remaining))
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -7,13 +7,27 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/jumagaliev1/birgeDo/internal/data"
 	"github.com/justinas/nosurf"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
 )
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, name string, td *templateData) {
-	ts, ok := app.templateCache[name]
+	td = app.addDefaultData(td, r)
+	cache := app.templateCache
+	if user := td.AuthenticatedUser; user != nil && user.TimeZone != "" && user.TimeZone != "UTC" {
+		loc, err := time.LoadLocation(user.TimeZone)
+		if err == nil {
+			cache, err = app.zoneTemplates.get(loc)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	}
+
+	ts, ok := cache[name]
 	if !ok {
 		app.serverError(w, fmt.Errorf("The template %s does not exist", name))
 		return
@@ -21,7 +35,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, name stri
 
 	buf := new(bytes.Buffer)
 
-	err := ts.Execute(buf, app.addDefaultData(td, r))
+	err := ts.Execute(buf, td)
 	if err != nil {
 		app.serverError(w, err)
 	}
@@ -36,6 +50,14 @@ func (app *application) addDefaultData(td *templateData, r *http.Request) *templ
 	td.AuthenticatedUser = app.authenticatedUser(r)
 	td.CurrentYear = time.Now().Year()
 	td.Flash = app.session.PopString(r, "flash")
+	td.Providers = app.providers
+	if td.AuthenticatedUser != nil {
+		unread, err := app.models.Notifications.CountUnread(td.AuthenticatedUser.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+		td.UnreadNotifications = unread
+	}
 
 	return td
 }
@@ -57,3 +79,61 @@ func (app *application) authenticatedUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// userInRoom reports whether the user is a member of the room.
+func (app *application) userInRoom(userID int, roomID int64) (bool, error) {
+	users, err := app.models.Users.GetUsersByRoom(int(roomID))
+	if err != nil {
+		return false, err
+	}
+	for _, id := range users {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordActivity adds an entry to the room's activity feed. The feed is only
+// informational, so a failure is logged instead of failing the request.
+func (app *application) recordActivity(roomID int64, userID int, taskID int64, action string) {
+	err := app.models.Activity.Insert(&data.Activity{RoomID: roomID, UserID: userID, TaskID: taskID, Action: action})
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"action": action})
+	}
+}
+
+// audit records a change to the user's account made by the actor. Either
+// may be zero, and r is nil for changes the system makes on its own.
+func (app *application) audit(r *http.Request, actorID, userID int, action, details string) {
+	entry := &data.AuditEntry{ActorID: actorID, UserID: userID, Action: action, Details: details}
+	if r != nil {
+		entry.IP = clientIP(r)
+	}
+	err := app.models.Audit.Insert(entry)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"action": action})
+	}
+}
+
+// background runs fn in a goroutine, logging a panic instead of crashing
+// the server.
+func (app *application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+		fn()
+	}()
+}
+
+// clientIP returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
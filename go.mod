@@ -1,19 +1,29 @@
 module github.com/jumagaliev1/birgeDo
 
-go 1.18
+go 1.21
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
-	golang.org/x/crypto v0.5.0
+	golang.org/x/crypto v0.25.0
 )
 
 require (
+	github.com/coreos/go-oidc/v3 v3.11.0
 	github.com/justinas/alice v1.2.0
+	github.com/justinas/nosurf v1.1.1
 	github.com/lib/pq v1.10.7
+	github.com/microcosm-cc/bluemonday v1.0.18
+	github.com/yuin/goldmark v1.5.6
+	golang.org/x/image v0.18.0
+	golang.org/x/oauth2 v0.21.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+	rsc.io/qr v0.2.0
 )
 
 require (
-	github.com/golangcollege/sessions v1.2.0 // indirect
-	github.com/justinas/nosurf v1.1.1 // indirect
-	golang.org/x/sys v0.4.0 // indirect
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/go-jose/go-jose/v4 v4.0.2 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	golang.org/x/net v0.27.0 // indirect
 )
@@ -0,0 +1,138 @@
+// Package conf layers a YAML configuration file and environment variables
+// under the flags of a command. The flags themselves describe the settings:
+// a flag such as -db-max-open-conns is set by the db.max_open_conns key of
+// the file and by the BIRGEDO_DB_MAX_OPEN_CONNS environment variable, so
+// defaults, the file, the environment and the command line apply in that
+// order.
+package conf
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix starts the environment variables of all settings.
+const EnvPrefix = "BIRGEDO_"
+
+// key returns the file key of a flag, such as "db.max_open_conns" for
+// "db-max-open-conns". Only the first dash separates a section, so
+// -base-url is the top level key base_url when there is no base section.
+func key(name string, sections map[string]bool) string {
+	section, rest, ok := strings.Cut(name, "-")
+	if ok && sections[section] {
+		return section + "." + strings.ReplaceAll(rest, "-", "_")
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// EnvName returns the environment variable of a flag, such as
+// BIRGEDO_DB_MAX_OPEN_CONNS for "db-max-open-conns".
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// flatten turns nested mappings into dotted keys.
+func flatten(prefix string, in map[string]interface{}, out map[string]interface{}) {
+	for k, v := range in {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			flatten(k, m, out)
+			continue
+		}
+		out[k] = v
+	}
+}
+
+// ReadFile sets the named flags of fs from the YAML file at path. Sections
+// lists the names that group settings in the file, such as "db". Keys that
+// match none of the flags are an error, so typos do not go unnoticed.
+func ReadFile(fs *flag.FlagSet, names []string, sections []string, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return fmt.Errorf("conf: %s: %w", path, err)
+	}
+	values := make(map[string]interface{})
+	flatten("", doc, values)
+
+	isSection := make(map[string]bool)
+	for _, section := range sections {
+		isSection[section] = true
+	}
+	byKey := make(map[string]string)
+	for _, name := range names {
+		byKey[key(name, isSection)] = name
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name, ok := byKey[k]
+		if !ok {
+			return fmt.Errorf("conf: %s: unknown setting %q", path, k)
+		}
+		switch values[k].(type) {
+		case nil:
+			continue
+		case []interface{}:
+			return fmt.Errorf("conf: %s: %s: a list is not a valid value", path, k)
+		}
+		err = fs.Set(name, fmt.Sprint(values[k]))
+		if err != nil {
+			return fmt.Errorf("conf: %s: %s: %w", path, k, err)
+		}
+	}
+	return nil
+}
+
+// ReadEnv sets the named flags of fs from their environment variables, as
+// returned by lookup. Pass os.LookupEnv outside of tests.
+func ReadEnv(fs *flag.FlagSet, names []string, lookup func(string) (string, bool)) error {
+	for _, name := range names {
+		value, ok := lookup(EnvName(name))
+		if !ok {
+			continue
+		}
+		err := fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("conf: %s: %w", EnvName(name), err)
+		}
+	}
+	return nil
+}
+
+// Path returns the value of the -config flag in args, or of the
+// BIRGEDO_CONFIG environment variable when args have none. It is needed
+// before the flags are parsed, as the file goes under them.
+func Path(args []string, lookup func(string) (string, bool)) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	path, _ := lookup(EnvName("config"))
+	return path
+}
@@ -0,0 +1,302 @@
+package conf
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSections = []string{"db", "smtp"}
+
+// settings are the flags the tests read, a small copy of the site's own.
+type settings struct {
+	port         int
+	baseURL      string
+	dsn          string
+	maxOpenConns int
+	maxIdleTime  time.Duration
+	smtpHost     string
+	secure       bool
+}
+
+func newFlagSet(s *settings) (*flag.FlagSet, []string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("config", "", "")
+	fs.IntVar(&s.port, "port", 4000, "")
+	fs.StringVar(&s.baseURL, "base-url", "http://localhost:4000", "")
+	fs.StringVar(&s.dsn, "db-dsn", "postgres://localhost/birgedo", "")
+	fs.IntVar(&s.maxOpenConns, "db-max-open-conns", 25, "")
+	fs.DurationVar(&s.maxIdleTime, "db-max-idle-time", 15*time.Minute, "")
+	fs.StringVar(&s.smtpHost, "smtp-host", "localhost", "")
+	fs.BoolVar(&s.secure, "session-secure", false, "")
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			names = append(names, f.Name)
+		}
+	})
+	return fs, names
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "birgedo.yaml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestKey(t *testing.T) {
+	sections := map[string]bool{"db": true, "smtp": true}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"port", "port"},
+		{"db-dsn", "db.dsn"},
+		{"db-max-open-conns", "db.max_open_conns"},
+		{"smtp-host", "smtp.host"},
+		{"base-url", "base_url"},
+		{"session-secure", "session_secure"},
+	}
+	for _, tt := range tests {
+		if got := key(tt.name, sections); got != tt.want {
+			t.Errorf("key(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"port", "BIRGEDO_PORT"},
+		{"db-max-open-conns", "BIRGEDO_DB_MAX_OPEN_CONNS"},
+		{"config", "BIRGEDO_CONFIG"},
+	}
+	for _, tt := range tests {
+		if got := EnvName(tt.name); got != tt.want {
+			t.Errorf("EnvName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	env := lookupIn(map[string]string{"BIRGEDO_CONFIG": "/etc/env.yaml"})
+	none := lookupIn(nil)
+	tests := []struct {
+		name   string
+		args   []string
+		lookup func(string) (string, bool)
+		want   string
+	}{
+		{"equals", []string{"-config=/etc/a.yaml"}, none, "/etc/a.yaml"},
+		{"double dash equals", []string{"--config=/etc/a.yaml"}, none, "/etc/a.yaml"},
+		{"separate value", []string{"-port", "80", "--config", "/etc/a.yaml"}, none, "/etc/a.yaml"},
+		{"empty value", []string{"-config="}, env, ""},
+		{"flag wins over env", []string{"-config=/etc/a.yaml"}, env, "/etc/a.yaml"},
+		{"env", []string{"-port=80"}, env, "/etc/env.yaml"},
+		{"none", []string{"-port=80"}, none, ""},
+		{"after terminator", []string{"--", "-config=/etc/a.yaml"}, none, ""},
+		{"other flag", []string{"-configure=/etc/a.yaml"}, none, ""},
+		{"argument", []string{"config=/etc/a.yaml"}, none, ""},
+		{"missing value", []string{"-config"}, env, "/etc/env.yaml"},
+	}
+	for _, tt := range tests {
+		if got := Path(tt.args, tt.lookup); got != tt.want {
+			t.Errorf("%s: Path(%q) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    settings
+		wantErr string
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    settings{port: 4000, baseURL: "http://localhost:4000", dsn: "postgres://localhost/birgedo", maxOpenConns: 25, maxIdleTime: 15 * time.Minute, smtpHost: "localhost"},
+		},
+		{
+			name: "sections and top level keys",
+			content: `port: 8080
+base_url: https://birgedo.kz
+session_secure: true
+db:
+  dsn: postgres://db/birgedo
+  max_open_conns: 50
+  max_idle_time: 5m
+smtp:
+  host: mail.birgedo.kz
+`,
+			want: settings{port: 8080, baseURL: "https://birgedo.kz", dsn: "postgres://db/birgedo", maxOpenConns: 50, maxIdleTime: 5 * time.Minute, smtpHost: "mail.birgedo.kz", secure: true},
+		},
+		{
+			name:    "null keeps the default",
+			content: "port: ~\ndb:\n  dsn: null\n",
+			want:    settings{port: 4000, baseURL: "http://localhost:4000", dsn: "postgres://localhost/birgedo", maxOpenConns: 25, maxIdleTime: 15 * time.Minute, smtpHost: "localhost"},
+		},
+		{name: "unknown key", content: "prot: 8080\n", wantErr: `unknown setting "prot"`},
+		{name: "unknown key in a section", content: "db:\n  dns: x\n", wantErr: `unknown setting "db.dns"`},
+		{name: "section flag written flat", content: "db_dsn: x\n", wantErr: `unknown setting "db_dsn"`},
+		{name: "config itself", content: "config: other.yaml\n", wantErr: `unknown setting "config"`},
+		{name: "list", content: "port: [1, 2]\n", wantErr: "a list is not a valid value"},
+		{name: "invalid value", content: "port: eighty\n", wantErr: "port"},
+		{name: "invalid duration", content: "db:\n  max_idle_time: 5\n", wantErr: "db.max_idle_time"},
+		{name: "invalid YAML", content: "port: [\n", wantErr: "conf:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s settings
+			fs, names := newFlagSet(&s)
+			err := ReadFile(fs, names, testSections, writeFile(t, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("settings = %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	var s settings
+	fs, names := newFlagSet(&s)
+	err := ReadFile(fs, names, testSections, filepath.Join(t.TempDir(), "missing.yaml"))
+	if !os.IsNotExist(err) {
+		t.Errorf("err = %v, want a missing file", err)
+	}
+}
+
+func TestReadEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    settings
+		wantErr string
+	}{
+		{
+			name: "none",
+			want: settings{port: 4000, baseURL: "http://localhost:4000", dsn: "postgres://localhost/birgedo", maxOpenConns: 25, maxIdleTime: 15 * time.Minute, smtpHost: "localhost"},
+		},
+		{
+			name: "set",
+			env: map[string]string{
+				"BIRGEDO_PORT":              "8080",
+				"BIRGEDO_DB_DSN":            "postgres://db/birgedo",
+				"BIRGEDO_DB_MAX_OPEN_CONNS": "10",
+				"BIRGEDO_SESSION_SECURE":    "true",
+				"BIRGEDO_SMTP_HOST":         "",
+				"PORT":                      "9090",
+			},
+			want: settings{port: 8080, baseURL: "http://localhost:4000", dsn: "postgres://db/birgedo", maxOpenConns: 10, maxIdleTime: 15 * time.Minute, secure: true},
+		},
+		{name: "invalid value", env: map[string]string{"BIRGEDO_DB_MAX_IDLE_TIME": "soon"}, wantErr: "BIRGEDO_DB_MAX_IDLE_TIME"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s settings
+			fs, names := newFlagSet(&s)
+			err := ReadEnv(fs, names, lookupIn(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("settings = %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrecedence loads the settings the way the commands do: defaults, then
+// the file, then the environment, then the command line.
+func TestPrecedence(t *testing.T) {
+	file := writeFile(t, "port: 5000\ndb:\n  dsn: postgres://file/birgedo\n  max_open_conns: 30\nsmtp:\n  host: file.smtp\n")
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want settings
+	}{
+		{
+			name: "file over defaults",
+			args: []string{"-config=" + file},
+			want: settings{port: 5000, baseURL: "http://localhost:4000", dsn: "postgres://file/birgedo", maxOpenConns: 30, maxIdleTime: 15 * time.Minute, smtpHost: "file.smtp"},
+		},
+		{
+			name: "env over file",
+			env:  map[string]string{"BIRGEDO_PORT": "6000", "BIRGEDO_DB_MAX_IDLE_TIME": "1m"},
+			args: []string{"-config", file},
+			want: settings{port: 6000, baseURL: "http://localhost:4000", dsn: "postgres://file/birgedo", maxOpenConns: 30, maxIdleTime: time.Minute, smtpHost: "file.smtp"},
+		},
+		{
+			name: "flags over env and file",
+			env:  map[string]string{"BIRGEDO_PORT": "6000", "BIRGEDO_SMTP_HOST": "env.smtp"},
+			args: []string{"-config=" + file, "-port=7000", "-db-max-open-conns", "40"},
+			want: settings{port: 7000, baseURL: "http://localhost:4000", dsn: "postgres://file/birgedo", maxOpenConns: 40, maxIdleTime: 15 * time.Minute, smtpHost: "env.smtp"},
+		},
+		{
+			name: "file from the environment",
+			env:  map[string]string{"BIRGEDO_CONFIG": file},
+			args: []string{"-session-secure"},
+			want: settings{port: 5000, baseURL: "http://localhost:4000", dsn: "postgres://file/birgedo", maxOpenConns: 30, maxIdleTime: 15 * time.Minute, smtpHost: "file.smtp", secure: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s settings
+			fs, names := newFlagSet(&s)
+			lookup := lookupIn(tt.env)
+			if path := Path(tt.args, lookup); path != "" {
+				err := ReadFile(fs, names, testSections, path)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := ReadEnv(fs, names, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = fs.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("settings = %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// AccountDeletionGrace is how long an account lives on after its user asked
+// for it to be deleted. Until then the request can be cancelled.
+const AccountDeletionGrace = 14 * 24 * time.Hour
+
+// DeletedUserName replaces the name of a deleted user, which still shows up
+// in the history of the rooms they were in.
+const DeletedUserName = "Deleted user"
+
+// DeletionDue returns when the account is deleted, or zero if its user
+// has not asked for that.
+func (u User) DeletionDue() time.Time {
+	if u.DeletionRequestedAt.IsZero() {
+		return time.Time{}
+	}
+	return u.DeletionRequestedAt.Add(AccountDeletionGrace)
+}
+
+// OwnedRoom is a room the user is the only admin of. When the account is
+// deleted the room is handed to the successor, or deleted along with the
+// account when the user has it to themselves.
+type OwnedRoom struct {
+	Room      Room
+	Successor *User
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ownedRooms returns the rooms the user is the only admin of. The successor
+// of each is the other member with the most completed tasks in the room.
+func ownedRooms(ctx context.Context, q queryer, userID int) ([]OwnedRoom, error) {
+	query := `
+		SELECT r.id, r.title, s.id, s.name
+		FROM rooms_users ru
+		INNER JOIN rooms r ON r.id = ru.room_id
+		LEFT JOIN LATERAL (
+			SELECT u.id, u.name FROM rooms_users o
+			INNER JOIN users u ON u.id = o.user_id
+			WHERE o.room_id = ru.room_id AND o.user_id <> $1
+			ORDER BY (SELECT COUNT(*) FROM task_history h
+				WHERE h.room_id = o.room_id AND h.user_id = o.user_id AND h.done) DESC, u.id
+			LIMIT 1
+		) s ON true
+		WHERE ru.user_id = $1 AND ru.admin
+		AND NOT EXISTS (SELECT 1 FROM rooms_users a
+			WHERE a.room_id = ru.room_id AND a.admin AND a.user_id <> $1)
+		ORDER BY r.title, r.id`
+
+	rows, err := q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []OwnedRoom
+	for rows.Next() {
+		var room OwnedRoom
+		var successorID sql.NullInt64
+		var successorName sql.NullString
+		err = rows.Scan(&room.Room.ID, &room.Room.Title, &successorID, &successorName)
+		if err != nil {
+			return nil, err
+		}
+		if successorID.Valid {
+			room.Successor = &User{ID: int(successorID.Int64), Name: successorName.String}
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// OwnedRooms returns what deleting the user's account would do to the rooms
+// only they administer.
+func (m UserModel) OwnedRooms(userID int) ([]OwnedRoom, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return ownedRooms(ctx, m.DB, userID)
+}
+
+// RequestDeletion schedules the deletion of the user's account. A pending
+// request keeps its original time.
+func (m UserModel) RequestDeletion(user *User) error {
+	query := `
+		UPDATE users SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()), version = version + 1
+		WHERE id = $1 AND version = $2
+		RETURNING deletion_requested_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.DeletionRequestedAt, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelDeletion withdraws the user's request to delete their account.
+func (m UserModel) CancelDeletion(user *User) error {
+	query := `
+		UPDATE users SET deletion_requested_at = NULL, version = version + 1
+		WHERE id = $1 AND version = $2
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	user.DeletionRequestedAt = time.Time{}
+	return nil
+}
+
+// GetDueDeletions returns the IDs of the users whose deletion request is
+// older than the grace period.
+func (m UserModel) GetDueDeletions(grace time.Duration) ([]int, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_requested_at < $1 AND deleted_at IS NULL
+		ORDER BY deletion_requested_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-grace))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteAccount deletes the user's account in one transaction. Rooms only
+// they administer go to their successor or are deleted, and everything that
+// belongs to the user is removed. The user row itself stays behind under an
+// anonymous name, so the completions in task_history keep counting towards
+// the statistics of their rooms. It returns the blob keys of the deleted
+// proof photos, which the caller has to delete from the blob store.
+func (m UserModel) DeleteAccount(userID int) ([]string, error) {
+	// The account keeps a password nobody knows, so it can never log in.
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	var locked password
+	err = locked.Set(base64.RawURLEncoding.EncodeToString(b))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rooms, err := ownedRooms(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var deletedRooms []int64
+	for _, room := range rooms {
+		if room.Successor == nil {
+			deletedRooms = append(deletedRooms, room.Room.ID)
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE rooms_users SET admin = true
+			WHERE user_id = $1 AND room_id = $2`, room.Successor.ID, room.Room.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Proofs of the deleted rooms would go with them, so their photos are
+	// collected here as well.
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM proofs
+		WHERE user_id = $1 OR task_id IN (SELECT id FROM tasks WHERE room_id = ANY($2))
+		RETURNING image_key, thumb_key`, userID, pq.Array(deletedRooms))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var image, thumb string
+		err = rows.Scan(&image, &thumb)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, image, thumb)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = ANY($1)`, pq.Array(deletedRooms))
+	if err != nil {
+		return nil, err
+	}
+	statements := []string{
+		`DELETE FROM rooms_users WHERE user_id = $1`,
+		`DELETE FROM users_tasks WHERE user_id = $1`,
+		`DELETE FROM users_task_items WHERE user_id = $1`,
+		`DELETE FROM task_assignees WHERE user_id = $1`,
+		`UPDATE task_duties SET ended_at = NOW() WHERE user_id = $1 AND ended_at IS NULL`,
+		`DELETE FROM comments WHERE user_id = $1`,
+		`DELETE FROM notifications WHERE user_id = $1`,
+		`DELETE FROM tags WHERE user_id = $1`,
+		`DELETE FROM room_templates WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM email_changes WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET name = $2, email = 'deleted-' || id || '@deleted.invalid', password_hash = $3,
+			activated = false, admin = false, totp_secret = '', totp_enabled = false,
+			muted_notifications = '{}', deletion_requested_at = NULL, deleted_at = NOW(),
+			version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, userID, DeletedUserName, locked.hash)
+	if err != nil {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return keys, tx.Commit()
+}
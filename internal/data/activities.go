@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Activity actions recorded in the rooms' activity feed.
+const (
+	ActivityCompleted = "completed"
+	ActivityCreated   = "created"
+	ActivityCommented = "commented"
+)
+
+// Activity is an entry of a room's activity feed: a member doing something
+// with one of the room's tasks.
+type Activity struct {
+	ID        int64     `json:"id"`
+	RoomID    int64     `json:"room_id"`
+	RoomTitle string    `json:"room_title"`
+	UserID    int       `json:"user_id"`
+	User      string    `json:"user"`
+	TaskID    int64     `json:"task_id"`
+	TaskTitle string    `json:"task_title"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ActivityModel struct {
+	DB *sql.DB
+}
+
+func (m ActivityModel) Insert(activity *Activity) error {
+	query := `
+		INSERT INTO activities (room_id, user_id, task_id, action)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	args := []interface{}{activity.RoomID, activity.UserID, activity.TaskID, activity.Action}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&activity.ID, &activity.CreatedAt)
+}
+
+// GetForRoom returns the latest activities in a room, newest first.
+func (m ActivityModel) GetForRoom(roomID int64, limit int) ([]Activity, error) {
+	query := `
+		SELECT a.id, a.room_id, r.title, a.user_id, u.name, a.task_id, t.title, a.action, a.created_at
+		FROM activities a
+		INNER JOIN rooms r ON r.id = a.room_id
+		INNER JOIN users u ON u.id = a.user_id
+		INNER JOIN tasks t ON t.id = a.task_id
+		WHERE a.room_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $2`
+
+	return m.query(query, roomID, limit)
+}
+
+// GetForUser returns the latest activities in all rooms the user is a member
+// of, newest first.
+func (m ActivityModel) GetForUser(userID int, limit int) ([]Activity, error) {
+	query := `
+		SELECT a.id, a.room_id, r.title, a.user_id, u.name, a.task_id, t.title, a.action, a.created_at
+		FROM activities a
+		INNER JOIN rooms_users ru ON ru.room_id = a.room_id AND ru.user_id = $1
+		INNER JOIN rooms r ON r.id = a.room_id
+		INNER JOIN users u ON u.id = a.user_id
+		INNER JOIN tasks t ON t.id = a.task_id
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $2`
+
+	return m.query(query, userID, limit)
+}
+
+func (m ActivityModel) query(query string, args ...interface{}) ([]Activity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	for rows.Next() {
+		var a Activity
+		err = rows.Scan(&a.ID, &a.RoomID, &a.RoomTitle, &a.UserID, &a.User, &a.TaskID, &a.TaskTitle, &a.Action, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, a)
+	}
+	return activities, rows.Err()
+}
@@ -0,0 +1,231 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Search returns a page of the accounts whose name or email contains
+// search, newest first. Deleted accounts are left out.
+func (m UserModel) Search(search string, limit, offset int) ([]User, error) {
+	query := `
+		SELECT id, created_at, name, email, admin, totp_enabled, deletion_requested_at,
+			deactivated_at, password_reset_required
+		FROM users
+		WHERE deleted_at IS NULL
+		AND ($1 = '' OR name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		var deletionRequestedAt, deactivatedAt sql.NullTime
+		err = rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Admin,
+			&user.TOTPEnabled,
+			&deletionRequestedAt,
+			&deactivatedAt,
+			&user.PasswordResetRequired,
+		)
+		if err != nil {
+			return nil, err
+		}
+		user.DeletionRequestedAt = deletionRequestedAt.Time
+		user.DeactivatedAt = deactivatedAt.Time
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// SetDeactivated deactivates or reactivates the account. Deactivating an
+// account that already is keeps its original time.
+func (m UserModel) SetDeactivated(userID int, deactivated bool) error {
+	query := `
+		UPDATE users
+		SET deactivated_at = CASE WHEN $2 THEN COALESCE(deactivated_at, NOW()) END, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, deactivated)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RequirePasswordReset makes the user choose a new password the next time
+// they log in.
+func (m UserModel) RequirePasswordReset(userID int) error {
+	query := `
+		UPDATE users SET password_reset_required = true, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetAdmin grants or revokes the user's access to the admin console.
+func (m UserModel) SetAdmin(userID int, admin bool) error {
+	query := `
+		UPDATE users SET admin = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, admin)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RoomSummary is a room with its size, as listed in the admin console.
+type RoomSummary struct {
+	Room         Room
+	Members      int
+	Tasks        int
+	Admins       []string
+	LastActivity time.Time
+}
+
+// GetSummaries returns a page of the rooms whose title contains search,
+// largest first.
+func (m RoomModel) GetSummaries(search string, limit, offset int) ([]RoomSummary, error) {
+	query := `
+		SELECT r.id, r.title, r.verification,
+			(SELECT COUNT(*) FROM rooms_users ru WHERE ru.room_id = r.id),
+			(SELECT COUNT(*) FROM tasks t WHERE t.room_id = r.id),
+			COALESCE((SELECT array_agg(u.name ORDER BY u.name) FROM rooms_users ru
+				INNER JOIN users u ON u.id = ru.user_id
+				WHERE ru.room_id = r.id AND ru.admin), '{}'),
+			(SELECT MAX(a.created_at) FROM activities a WHERE a.room_id = r.id)
+		FROM rooms r
+		WHERE ($1 = '' OR r.title ILIKE '%' || $1 || '%')
+		ORDER BY 4 DESC, 5 DESC, r.id
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []RoomSummary
+	for rows.Next() {
+		var room RoomSummary
+		var lastActivity sql.NullTime
+		err = rows.Scan(
+			&room.Room.ID,
+			&room.Room.Title,
+			&room.Room.Verification,
+			&room.Members,
+			&room.Tasks,
+			pq.Array(&room.Admins),
+			&lastActivity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		room.LastActivity = lastActivity.Time
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// Delete deletes the room with its tasks and history. It returns the blob
+// keys of the proof photos that went with it, which the caller has to delete
+// from the blob store.
+func (m RoomModel) Delete(id int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT p.image_key, p.thumb_key FROM proofs p
+		INNER JOIN tasks t ON t.id = p.task_id
+		WHERE t.room_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var image, thumb string
+		err = rows.Scan(&image, &thumb)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, image, thumb)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return keys, tx.Commit()
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Audit actions. Those starting with "admin." are taken by a site admin on
+// another user's account.
+const (
+	AuditPasswordChanged     = "password.changed"
+	AuditEmailChanged        = "email.changed"
+	AuditTwoFactorEnabled    = "2fa.enabled"
+	AuditTwoFactorDisabled   = "2fa.disabled"
+	AuditSessionsRevoked     = "sessions.revoked"
+	AuditDeletionRequested   = "account.deletion_requested"
+	AuditDeletionCancelled   = "account.deletion_cancelled"
+	AuditAccountDeleted      = "account.deleted"
+	AuditAdminDeactivated    = "admin.deactivated"
+	AuditAdminReactivated    = "admin.reactivated"
+	AuditAdminPasswordReset  = "admin.password_reset"
+	AuditAdminTwoFactorReset = "admin.2fa_reset"
+	AuditAdminPromoted       = "admin.promoted"
+	AuditAdminDemoted        = "admin.demoted"
+)
+
+// AuditActions lists the audit actions in the order the audit log filter
+// offers them.
+var AuditActions = []string{
+	AuditPasswordChanged,
+	AuditEmailChanged,
+	AuditTwoFactorEnabled,
+	AuditTwoFactorDisabled,
+	AuditSessionsRevoked,
+	AuditDeletionRequested,
+	AuditDeletionCancelled,
+	AuditAccountDeleted,
+	AuditAdminDeactivated,
+	AuditAdminReactivated,
+	AuditAdminPasswordReset,
+	AuditAdminTwoFactorReset,
+	AuditAdminPromoted,
+	AuditAdminDemoted,
+}
+
+// AuditEntry records a change to an account. The actor is who made it, zero
+// for the system, and the user is whose account it was.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	ActorID   int       `json:"actor_id,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	UserID    int       `json:"user_id,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditFilters narrow down the audit log. Search matches the name or email
+// of the actor or the user.
+type AuditFilters struct {
+	Action string
+	Search string
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, user_id, action, details, ip)
+		VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []interface{}{entry.ActorID, entry.UserID, entry.Action, entry.Details, entry.IP}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAll returns a page of the audit log entries that match the filters,
+// newest first.
+func (m AuditModel) GetAll(filters AuditFilters, limit, offset int) ([]AuditEntry, error) {
+	query := `
+		SELECT l.id, COALESCE(l.actor_id, 0), COALESCE(a.name, ''), COALESCE(l.user_id, 0), COALESCE(u.name, ''),
+			l.action, l.details, l.ip, l.created_at
+		FROM audit_log l
+		LEFT JOIN users a ON a.id = l.actor_id
+		LEFT JOIN users u ON u.id = l.user_id
+		WHERE ($1 = '' OR l.action = $1)
+		AND ($2 = '' OR a.name ILIKE '%' || $2 || '%' OR a.email ILIKE '%' || $2 || '%'
+			OR u.name ILIKE '%' || $2 || '%' OR u.email ILIKE '%' || $2 || '%')
+		ORDER BY l.created_at DESC, l.id DESC
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.Action, filters.Search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err = rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.Actor,
+			&entry.UserID,
+			&entry.User,
+			&entry.Action,
+			&entry.Details,
+			&entry.IP,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CommentEditWindow is how long after posting the author may still edit a
+// comment.
+const CommentEditWindow = 15 * time.Minute
+
+// Comment is a Markdown message in the discussion thread of a task.
+type Comment struct {
+	ID        int64     `json:"id"`
+	TaskID    int64     `json:"task_id"`
+	UserID    int       `json:"user_id"`
+	User      string    `json:"user"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Editable reports whether the comment is still within its edit window.
+func (c Comment) Editable() bool {
+	return time.Since(c.CreatedAt) < CommentEditWindow
+}
+
+// Edited reports whether the comment was changed after it was posted.
+func (c Comment) Edited() bool {
+	return !c.UpdatedAt.IsZero()
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO comments (task_id, user_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, comment.TaskID, comment.UserID, comment.Body).Scan(&comment.ID, &comment.CreatedAt)
+}
+
+func (m CommentModel) GetByID(id int64) (*Comment, error) {
+	query := `
+		SELECT c.id, c.task_id, c.user_id, u.name, c.body, c.created_at, c.updated_at
+		FROM comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var comment Comment
+	var updatedAt sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&comment.ID,
+		&comment.TaskID,
+		&comment.UserID,
+		&comment.User,
+		&comment.Body,
+		&comment.CreatedAt,
+		&updatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	comment.UpdatedAt = updatedAt.Time
+	return &comment, nil
+}
+
+// GetByTaskID returns the comment thread of a task, oldest first.
+func (m CommentModel) GetByTaskID(taskID int64) ([]Comment, error) {
+	query := `
+		SELECT c.id, c.task_id, c.user_id, u.name, c.body, c.created_at, c.updated_at
+		FROM comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.task_id = $1
+		ORDER BY c.created_at, c.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var updatedAt sql.NullTime
+		err = rows.Scan(
+			&comment.ID,
+			&comment.TaskID,
+			&comment.UserID,
+			&comment.User,
+			&comment.Body,
+			&comment.CreatedAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comment.UpdatedAt = updatedAt.Time
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// GetByUser returns every comment the user wrote, oldest first.
+func (m CommentModel) GetByUser(userID int) ([]Comment, error) {
+	query := `
+		SELECT c.id, c.task_id, c.user_id, u.name, c.body, c.created_at, c.updated_at
+		FROM comments c
+		INNER JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = $1
+		ORDER BY c.created_at, c.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var updatedAt sql.NullTime
+		err = rows.Scan(
+			&comment.ID,
+			&comment.TaskID,
+			&comment.UserID,
+			&comment.User,
+			&comment.Body,
+			&comment.CreatedAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comment.UpdatedAt = updatedAt.Time
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// Update stores a new body for the comment. Comments past their edit window
+// are reported as an edit conflict.
+func (m CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE comments SET body = $2, updated_at = NOW()
+		WHERE id = $1 AND created_at > NOW() - make_interval(secs => $3)
+		RETURNING updated_at`
+
+	args := []interface{}{comment.ID, comment.Body, CommentEditWindow.Seconds()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CommentModel) Delete(id int64) error {
+	query := `
+		DELETE FROM comments
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDB returns a connection to a fresh schema of the database named by
+// $BIRGEDO_TEST_DSN with all migrations applied. Tests that need it are
+// skipped when the variable is not set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("BIRGEDO_TEST_DSN")
+	if dsn == "" {
+		t.Skip("BIRGEDO_TEST_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE EXTENSION IF NOT EXISTS citext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return
+		}
+		defer db.Close()
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+	})
+
+	// lib/pq sends unknown settings as run-time parameters, so every
+	// connection of the pool uses the new schema.
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema+",public")
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema + ",public"
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(content)) == "" {
+			continue
+		}
+		_, err = db.Exec(string(content))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
+
+// exec runs a statement that sets up a test.
+func exec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	_, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// insertID runs an INSERT ... RETURNING id and returns the ID.
+func insertID(t *testing.T, db *sql.DB, query string, args ...interface{}) int64 {
+	t.Helper()
+	var id int64
+	err := db.QueryRow(query, args...).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func insertUser(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+	return int(insertID(t, db, `
+		INSERT INTO users (name, email, password_hash, activated)
+		VALUES ($1, $2, '', true)
+		RETURNING id`, name, name+"@example.com"))
+}
+
+func insertRoom(t *testing.T, db *sql.DB, title string, verification bool, members ...int) int64 {
+	t.Helper()
+	roomID := insertID(t, db, `INSERT INTO rooms (title, verification) VALUES ($1, $2) RETURNING id`, title, verification)
+	for i, userID := range members {
+		exec(t, db, `INSERT INTO rooms_users (room_id, user_id, admin) VALUES ($1, $2, $3)`, roomID, userID, i == 0)
+	}
+	return roomID
+}
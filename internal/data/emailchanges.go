@@ -0,0 +1,95 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+// EmailChangeTTL is how long the link to confirm a new email address works.
+const EmailChangeTTL = 24 * time.Hour
+
+// EmailChange is a requested change of a user's email address, waiting for
+// the link sent to the new address to be followed.
+type EmailChange struct {
+	Plaintext string
+	Hash      []byte
+	UserID    int
+	Email     string
+	Expiry    time.Time
+}
+
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// New stores a pending change of the user's email address, replacing earlier
+// ones. The plaintext token of the returned change goes into the link.
+func (m EmailChangeModel) New(userID int, email string) (*EmailChange, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	change := &EmailChange{
+		Plaintext: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b),
+		UserID:    userID,
+		Email:     email,
+		Expiry:    time.Now().Add(EmailChangeTTL),
+	}
+	hash := sha256.Sum256([]byte(change.Plaintext))
+	change.Hash = hash[:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO email_changes (token_hash, user_id, email, expiry)
+		VALUES ($1, $2, $3, $4)`, change.Hash, change.UserID, change.Email, change.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	return change, tx.Commit()
+}
+
+// Take returns the unexpired change of the token and deletes it, so a link
+// works only once.
+func (m EmailChangeModel) Take(plaintext string) (*EmailChange, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		DELETE FROM email_changes
+		WHERE token_hash = $1
+		RETURNING user_id, email, expiry`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	change := EmailChange{Hash: hash[:]}
+	err := m.DB.QueryRowContext(ctx, query, change.Hash).Scan(&change.UserID, &change.Email, &change.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if time.Now().After(change.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+	return &change, nil
+}
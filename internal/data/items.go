@@ -0,0 +1,278 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TaskItem is a checklist entry of a task. Like the task itself, every
+// assigned user checks it off separately; Done holds the state of the user
+// the item was loaded for.
+type TaskItem struct {
+	ID       int64  `json:"id"`
+	TaskID   int64  `json:"task_id"`
+	Title    string `json:"title"`
+	Position int    `json:"position"`
+	Done     bool   `json:"done"`
+}
+
+type TaskItemModel struct {
+	DB *sql.DB
+}
+
+// Insert adds an item at the end of the task's checklist. The new item is
+// unchecked, so the task is no longer done for anyone who had finished it.
+func (m TaskItemModel) Insert(item *TaskItem) error {
+	query := `
+		INSERT INTO task_items (task_id, title, position)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(position), 0) + 1 FROM task_items WHERE task_id = $1))
+		RETURNING id, position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, item.TaskID, item.Title).Scan(&item.ID, &item.Position)
+	if err != nil {
+		return err
+	}
+	_, err = updateChecklistDone(ctx, tx, item.TaskID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m TaskItemModel) GetByID(id int64) (*TaskItem, error) {
+	query := `
+		SELECT id, task_id, title, position
+		FROM task_items
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var item TaskItem
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&item.ID, &item.TaskID, &item.Title, &item.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+// GetByTaskID returns the items of a task in checklist order, without any
+// per-user state.
+func (m TaskItemModel) GetByTaskID(taskID int64) ([]TaskItem, error) {
+	query := `
+		SELECT id, task_id, title, position
+		FROM task_items
+		WHERE task_id = $1
+		ORDER BY position, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TaskItem
+	for rows.Next() {
+		var item TaskItem
+		err = rows.Scan(&item.ID, &item.TaskID, &item.Title, &item.Position)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetByUser returns the items of every task assigned to the user, keyed by
+// task ID, together with the user's progress on each of them.
+func (m TaskItemModel) GetByUser(userID int) (map[int64][]TaskItem, error) {
+	query := `
+		SELECT ti.id, ti.task_id, ti.title, ti.position, COALESCE(uti.done, false)
+		FROM task_items ti
+		INNER JOIN users_tasks ut ON ut.task_id = ti.task_id AND ut.user_id = $1
+		LEFT JOIN users_task_items uti ON uti.item_id = ti.id AND uti.user_id = $1
+		ORDER BY ti.task_id, ti.position, ti.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int64][]TaskItem)
+	for rows.Next() {
+		var item TaskItem
+		err = rows.Scan(&item.ID, &item.TaskID, &item.Title, &item.Position, &item.Done)
+		if err != nil {
+			return nil, err
+		}
+		items[item.TaskID] = append(items[item.TaskID], item)
+	}
+	return items, rows.Err()
+}
+
+// Delete removes an item from its checklist. It returns the users who had
+// checked all the other items and so completed the task with the deletion;
+// in rooms with peer verification their completions still need a review.
+func (m TaskItemModel) Delete(id int64) ([]int, error) {
+	query := `
+		DELETE FROM task_items
+		WHERE id = $1
+		RETURNING task_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var taskID int64
+	err = tx.QueryRowContext(ctx, query, id).Scan(&taskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	completed, err := updateChecklistDone(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return completed, tx.Commit()
+}
+
+// updateChecklistDone recomputes the done state of every user of a task
+// after its checklist changed. A user is finished when every item is
+// checked, a required photo is attached and a counter task has reached its
+// target. In rooms with peer verification only an approved completion is
+// done; a finished user without a review yet is returned with those who
+// completed the task, so the caller can ask for one. Users who are no longer
+// finished lose their pending or approved review, as with AddProgress. A
+// task whose last item was removed keeps the state each user had.
+func updateChecklistDone(ctx context.Context, tx *sql.Tx, taskID int64) ([]int, error) {
+	query := `
+		WITH state AS (
+			SELECT ut.user_id, ut.done AS was_done, ut.review, r.verification,
+				NOT EXISTS (
+					SELECT 1 FROM task_items ti
+					LEFT JOIN users_task_items uti ON uti.item_id = ti.id AND uti.user_id = ut.user_id
+					WHERE ti.task_id = ut.task_id AND NOT COALESCE(uti.done, false))
+				AND (NOT t.requires_proof OR ut.proof_id IS NOT NULL)
+				AND (t.kind <> 'count' OR ut.progress >= t.target) AS finished
+			FROM users_tasks ut
+			INNER JOIN tasks t ON t.id = ut.task_id
+			INNER JOIN rooms r ON r.id = t.room_id
+			WHERE ut.task_id = $1
+			AND EXISTS (SELECT 1 FROM task_items WHERE task_id = $1))
+		UPDATE users_tasks ut
+		SET done = s.finished AND (NOT s.verification OR s.review = $2),
+			review = CASE WHEN s.finished THEN s.review ELSE '' END
+		FROM state s
+		WHERE ut.task_id = $1 AND ut.user_id = s.user_id
+		RETURNING ut.user_id, s.finished AND NOT s.was_done AND s.review = ''`
+
+	rows, err := tx.QueryContext(ctx, query, taskID, ReviewApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var completed []int
+	for rows.Next() {
+		var userID int
+		var ok bool
+		err = rows.Scan(&userID, &ok)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			completed = append(completed, userID)
+		}
+	}
+	return completed, rows.Err()
+}
+
+// Toggle flips the user's state of a checklist item and then marks the
+// parent task as done for the user exactly when all of its items are checked
+// and, for tasks that require proof, a photo has been attached.
+// It returns the parent task's ID and whether this toggle completed it.
+func (m TaskItemModel) Toggle(userID int, itemID int64) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var taskID int64
+	var wasDone bool
+	query := `
+		SELECT ti.task_id, ut.done FROM task_items ti
+		INNER JOIN users_tasks ut ON ut.task_id = ti.task_id AND ut.user_id = $1
+		WHERE ti.id = $2`
+	err = tx.QueryRowContext(ctx, query, userID, itemID).Scan(&taskID, &wasDone)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, ErrRecordNotFound
+		default:
+			return 0, false, err
+		}
+	}
+
+	query = `
+		INSERT INTO users_task_items (user_id, item_id, done)
+		VALUES ($1, $2, true)
+		ON CONFLICT (user_id, item_id) DO UPDATE SET done = NOT users_task_items.done`
+	_, err = tx.ExecContext(ctx, query, userID, itemID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var done bool
+	query = `
+		UPDATE users_tasks ut
+		SET done = NOT EXISTS (
+			SELECT 1 FROM task_items ti
+			LEFT JOIN users_task_items uti ON uti.item_id = ti.id AND uti.user_id = $1
+			WHERE ti.task_id = $2 AND NOT COALESCE(uti.done, false))
+			AND (NOT t.requires_proof OR ut.proof_id IS NOT NULL)
+		FROM tasks t
+		WHERE t.id = ut.task_id AND ut.user_id = $1 AND ut.task_id = $2
+		RETURNING ut.done`
+	err = tx.QueryRowContext(ctx, query, userID, taskID).Scan(&done)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return taskID, done && !wasDone, tx.Commit()
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDeleteItem removes the one item a user has not checked and looks at
+// what that makes of each user's completion.
+func TestDeleteItem(t *testing.T) {
+	type member struct {
+		checked  bool // whether the remaining item is checked
+		progress int
+		review   string
+	}
+	type result struct {
+		done   bool
+		review string
+	}
+	tests := []struct {
+		name         string
+		verification bool
+		kind         string
+		target       int
+		members      []member
+		want         []result
+		completed    []int // indexes into members
+	}{
+		{
+			name:      "no verification",
+			kind:      "check",
+			target:    1,
+			members:   []member{{checked: true}, {}},
+			want:      []result{{done: true}, {}},
+			completed: []int{0},
+		},
+		{
+			name:         "verification",
+			verification: true,
+			kind:         "check",
+			target:       1,
+			members: []member{
+				{checked: true},
+				{checked: true, review: ReviewPending},
+				{checked: true, review: ReviewRejected},
+				{review: ReviewPending},
+			},
+			want: []result{
+				{},
+				{review: ReviewPending},
+				{review: ReviewRejected},
+				{},
+			},
+			completed: []int{0},
+		},
+		{
+			name:      "count target",
+			kind:      "count",
+			target:    3,
+			members:   []member{{checked: true, progress: 1}, {checked: true, progress: 3}},
+			want:      []result{{}, {done: true}},
+			completed: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			m := TaskItemModel{DB: db}
+
+			var users []int
+			for i := range tt.members {
+				users = append(users, insertUser(t, db, string(rune('a'+i))))
+			}
+			roomID := insertRoom(t, db, "room", tt.verification, users...)
+			taskID := insertID(t, db, `
+				INSERT INTO tasks (title, room_id, kind, target)
+				VALUES ('task', $1, $2, $3)
+				RETURNING id`, roomID, tt.kind, tt.target)
+			kept := insertID(t, db, `INSERT INTO task_items (task_id, title) VALUES ($1, 'kept') RETURNING id`, taskID)
+			removed := insertID(t, db, `INSERT INTO task_items (task_id, title) VALUES ($1, 'removed') RETURNING id`, taskID)
+			for i, mb := range tt.members {
+				exec(t, db, `
+					INSERT INTO users_tasks (user_id, task_id, done, progress, review)
+					VALUES ($1, $2, false, $3, $4)`, users[i], taskID, mb.progress, mb.review)
+				exec(t, db, `
+					INSERT INTO users_task_items (user_id, item_id, done)
+					VALUES ($1, $2, $3)`, users[i], kept, mb.checked)
+			}
+
+			completed, err := m.Delete(removed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []int
+			for _, i := range tt.completed {
+				want = append(want, users[i])
+			}
+			if !reflect.DeepEqual(completed, want) {
+				t.Errorf("completed = %v, want %v", completed, want)
+			}
+			for i, w := range tt.want {
+				var got result
+				err := db.QueryRow(`SELECT done, review FROM users_tasks WHERE user_id = $1 AND task_id = $2`,
+					users[i], taskID).Scan(&got.done, &got.review)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != w {
+					t.Errorf("member %d: %+v, want %+v", i, got, w)
+				}
+			}
+
+			if _, err := m.Delete(removed); err != ErrRecordNotFound {
+				t.Errorf("deleting twice returned %v", err)
+			}
+		})
+	}
+}
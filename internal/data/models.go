@@ -9,13 +9,26 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
 	ErrDuplicateKey   = errors.New("duplicate key")
+	ErrNoAssignees    = errors.New("no assignees")
 	//ErrInvalidCredentials = errors.New("models: invalid credentials")
 )
 
 type Models struct {
-	Users UserModel
-	Task  TaskModel
-	Room  RoomModel
+	Users          UserModel
+	Task           TaskModel
+	Room           RoomModel
+	Templates      TemplateModel
+	Items          TaskItemModel
+	Tags           TagModel
+	Stats          StatsModel
+	Activity       ActivityModel
+	Notifications  NotificationModel
+	Comments       CommentModel
+	Proofs         ProofModel
+	TwoFactor      TwoFactorModel
+	LoginThrottles LoginThrottleModel
+	EmailChanges   EmailChangeModel
+	Audit          AuditModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -26,7 +39,19 @@ func NewModels(db *sql.DB) Models {
 		Task: TaskModel{
 			DB: db,
 		},
-		Room: RoomModel{DB: db},
+		Room:           RoomModel{DB: db},
+		Templates:      TemplateModel{DB: db},
+		Items:          TaskItemModel{DB: db},
+		Tags:           TagModel{DB: db},
+		Stats:          StatsModel{DB: db},
+		Activity:       ActivityModel{DB: db},
+		Notifications:  NotificationModel{DB: db},
+		Comments:       CommentModel{DB: db},
+		Proofs:         ProofModel{DB: db},
+		TwoFactor:      TwoFactorModel{DB: db},
+		LoginThrottles: LoginThrottleModel{DB: db},
+		EmailChanges:   EmailChangeModel{DB: db},
+		Audit:          AuditModel{DB: db},
 	}
 
 }
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Notification kinds.
+const (
+	NotificationRoomAdded = "room_added"
+	NotificationTaskAdded = "task_added"
+	NotificationReminder  = "reminder"
+	NotificationMention   = "mention"
+	NotificationReview    = "review"
+)
+
+// NotificationKinds lists the kinds of notifications users can turn off.
+var NotificationKinds = []string{
+	NotificationRoomAdded,
+	NotificationTaskAdded,
+	NotificationReminder,
+	NotificationMention,
+	NotificationReview,
+}
+
+// Notification is a persisted message for a single user, optionally pointing
+// to the page it is about.
+type Notification struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link,omitempty"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// Insert stores the notification unless the user turned off its kind, in
+// which case the ID stays zero.
+func (m NotificationModel) Insert(notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, kind, message, link)
+		SELECT id, $2, $3, $4 FROM users
+		WHERE id = $1 AND NOT $2 = ANY(muted_notifications)
+		RETURNING id, created_at`
+
+	args := []interface{}{notification.UserID, notification.Kind, notification.Message, notification.Link}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&notification.ID, &notification.CreatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// NotifyTaskAssignees sends a notification about a task to everyone it is
+// currently assigned to, except the user who caused it.
+func (m NotificationModel) NotifyTaskAssignees(taskID int64, actorID int, kind, message string) error {
+	query := `
+		INSERT INTO notifications (user_id, kind, message, link)
+		SELECT ut.user_id, $3, $4, $5 FROM users_tasks ut
+		INNER JOIN users u ON u.id = ut.user_id
+		WHERE ut.task_id = $1 AND ut.user_id <> $2 AND NOT $3 = ANY(u.muted_notifications)`
+
+	args := []interface{}{taskID, actorID, kind, message, fmt.Sprintf("/task/%d/view", taskID)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// NotifyRoomMembers sends a notification to every member of a room except
+// the user who caused it.
+func (m NotificationModel) NotifyRoomMembers(roomID int64, actorID int, kind, message, link string) error {
+	query := `
+		INSERT INTO notifications (user_id, kind, message, link)
+		SELECT ru.user_id, $3, $4, $5 FROM rooms_users ru
+		INNER JOIN users u ON u.id = ru.user_id
+		WHERE ru.room_id = $1 AND ru.user_id <> $2 AND NOT $3 = ANY(u.muted_notifications)`
+
+	args := []interface{}{roomID, actorID, kind, message, link}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// SendReminders notifies users about their pending tasks that are due within
+// the given period from now. Due times are in each user's time zone, and a
+// period running past midnight covers the early due times of the next day.
+// A task is reminded of at most once per due time.
+func (m NotificationModel) SendReminders(within time.Duration) (int64, error) {
+	query := `
+		WITH pending AS (
+			SELECT ut.user_id, t.id AS task_id, t.title, t.due_time,
+				(NOW() AT TIME ZONE COALESCE(tz.name, 'UTC'))::time AS now
+			FROM users_tasks ut
+			INNER JOIN tasks t ON t.id = ut.task_id
+			INNER JOIN users u ON u.id = ut.user_id
+			LEFT JOIN pg_timezone_names tz ON tz.name = u.time_zone
+			WHERE NOT ut.done AND t.due_time IS NOT NULL AND NOT $1 = ANY(u.muted_notifications)
+		)
+		INSERT INTO notifications (user_id, kind, message, link)
+		SELECT p.user_id, $1, 'Reminder: "' || p.title || '" is due at ' || to_char(p.due_time, 'HH24:MI'),
+			'/task/' || p.task_id || '/view'
+		FROM pending p
+		WHERE MOD(CAST(EXTRACT(EPOCH FROM p.due_time - p.now) AS numeric) + 86400, 86400) <= CAST($2 AS numeric)
+		AND NOT EXISTS (
+			SELECT 1 FROM notifications n
+			WHERE n.user_id = p.user_id AND n.kind = $1
+			AND n.link = '/task/' || p.task_id || '/view'
+			AND n.created_at > NOW() - interval '1 day' + make_interval(secs => $2))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, NotificationReminder, within.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetForUser returns the latest notifications of a user, newest first.
+func (m NotificationModel) GetForUser(userID int, limit int) ([]Notification, error) {
+	query := `
+		SELECT id, user_id, kind, message, link, read, created_at
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		err = rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.Link, &n.Read, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (m NotificationModel) CountUnread(userID int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM notifications
+		WHERE user_id = $1 AND NOT read`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a single notification of the user as read and returns it,
+// so the caller can follow its link.
+func (m NotificationModel) MarkRead(id int64, userID int) (*Notification, error) {
+	query := `
+		UPDATE notifications SET read = true
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, user_id, kind, message, link, read, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var n Notification
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.Link, &n.Read, &n.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &n, nil
+}
+
+func (m NotificationModel) MarkAllRead(userID int) error {
+	query := `
+		UPDATE notifications SET read = true
+		WHERE user_id = $1 AND NOT read`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSendReminders checks due times against a time zone where it is
+// currently between 23:00 and midnight, so that the window wraps into the
+// next day, and one where it is around noon.
+func TestSendReminders(t *testing.T) {
+	db := newTestDB(t)
+	m := NotificationModel{DB: db}
+
+	late, noon := insertUser(t, db, "late"), insertUser(t, db, "noon")
+	for userID, hour := range map[int]int{late: 23, noon: 12} {
+		exec(t, db, `
+			UPDATE users SET time_zone = (
+				SELECT name FROM pg_timezone_names
+				WHERE EXTRACT(HOUR FROM NOW() AT TIME ZONE name) = $2
+				ORDER BY name LIMIT 1)
+			WHERE id = $1`, userID, hour)
+	}
+	roomID := insertRoom(t, db, "room", false, late, noon)
+	for _, due := range []string{"00:30", "22:00"} {
+		taskID := insertID(t, db, `INSERT INTO tasks (title, room_id, due_time) VALUES ($1, $2, $1) RETURNING id`,
+			due, roomID)
+		exec(t, db, `INSERT INTO users_tasks (user_id, task_id, done) VALUES ($1, $2, false), ($3, $2, false)`, late, taskID, noon)
+	}
+
+	sent, err := m.SendReminders(2 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Errorf("sent %d reminders, want 1", sent)
+	}
+	var userID int
+	var message string
+	err = db.QueryRow(`SELECT user_id, message FROM notifications`).Scan(&userID, &message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != late || message != `Reminder: "00:30" is due at 00:30` {
+		t.Errorf("reminded user %d with %q, want user %d about 00:30", userID, message, late)
+	}
+
+	sent, err = m.SendReminders(2 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 0 {
+		t.Errorf("sent %d reminders again", sent)
+	}
+}
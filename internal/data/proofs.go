@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Proof is a photo a member attached when marking a task done. The image and
+// its thumbnail live in the blob store under the given keys.
+type Proof struct {
+	ID          int64     `json:"id"`
+	TaskID      int64     `json:"task_id"`
+	UserID      int       `json:"user_id"`
+	ImageKey    string    `json:"-"`
+	ThumbKey    string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ProofModel struct {
+	DB *sql.DB
+}
+
+// Insert stores the proof and links it to the user's assignment in one
+// transaction. The photo only completes the task when nothing else is
+// missing: every checklist item is checked and a counter task has reached
+// its target. A completion waiting for review is left as it is. Insert
+// reports whether the proof completed the task.
+func (m ProofModel) Insert(proof *Proof) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO proofs (task_id, user_id, image_key, thumb_key, content_type)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{proof.TaskID, proof.UserID, proof.ImageKey, proof.ThumbKey, proof.ContentType}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&proof.ID, &proof.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	var wasDone, done bool
+	query = `
+		UPDATE users_tasks ut
+		SET proof_id = $3,
+			done = ut.done OR (ut.review <> $4
+				AND NOT EXISTS (
+					SELECT 1 FROM task_items ti
+					LEFT JOIN users_task_items uti ON uti.item_id = ti.id AND uti.user_id = ut.user_id
+					WHERE ti.task_id = ut.task_id AND NOT COALESCE(uti.done, false))
+				AND (t.kind <> 'count' OR ut.progress >= t.target))
+		FROM tasks t, users_tasks prev
+		WHERE t.id = ut.task_id AND ut.user_id = $1 AND ut.task_id = $2
+		AND prev.user_id = ut.user_id AND prev.task_id = ut.task_id
+		RETURNING prev.done, ut.done`
+	err = tx.QueryRowContext(ctx, query, proof.UserID, proof.TaskID, proof.ID, ReviewPending).Scan(&wasDone, &done)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return done && !wasDone, tx.Commit()
+}
+
+func (m ProofModel) GetByID(id int64) (*Proof, error) {
+	query := `
+		SELECT id, task_id, user_id, image_key, thumb_key, content_type, created_at
+		FROM proofs
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var proof Proof
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&proof.ID,
+		&proof.TaskID,
+		&proof.UserID,
+		&proof.ImageKey,
+		&proof.ThumbKey,
+		&proof.ContentType,
+		&proof.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &proof, nil
+}
+
+// GetByUser returns every proof the user uploaded, oldest first.
+func (m ProofModel) GetByUser(userID int) ([]Proof, error) {
+	query := `
+		SELECT id, task_id, user_id, image_key, thumb_key, content_type, created_at
+		FROM proofs
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var proofs []Proof
+	for rows.Next() {
+		var proof Proof
+		err = rows.Scan(
+			&proof.ID,
+			&proof.TaskID,
+			&proof.UserID,
+			&proof.ImageKey,
+			&proof.ThumbKey,
+			&proof.ContentType,
+			&proof.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		proofs = append(proofs, proof)
+	}
+	return proofs, rows.Err()
+}
@@ -8,8 +8,9 @@ import (
 )
 
 type Room struct {
-	ID    int64  `json:"id"`
-	Title string `json:"title"`
+	ID           int64  `json:"id"`
+	Title        string `json:"title"`
+	Verification bool   `json:"verification"`
 }
 
 type RoomModel struct {
@@ -34,7 +35,7 @@ func (m RoomModel) Insert(room *Room) (int, error) {
 
 func (m RoomModel) GetByID(id int64) (*Room, error) {
 	query := `
-			SELECT id, title 
+			SELECT id, title, verification
 			FROM rooms
 			WHERE id = $1`
 	var room Room
@@ -43,7 +44,8 @@ func (m RoomModel) GetByID(id int64) (*Room, error) {
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&room.ID,
-		&room.Title)
+		&room.Title,
+		&room.Verification)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -80,3 +82,269 @@ func (m RoomModel) Update(room *Room) error {
 	}
 	return nil
 }
+
+// SetVerification turns peer verification of completions in a room on or
+// off.
+func (m RoomModel) SetVerification(roomID int64, on bool) error {
+	query := `
+		UPDATE rooms SET verification = $2
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, roomID, on)
+	return err
+}
+
+// Import adds the given tasks, with their checklist items, and members to a
+// room in a single transaction, so either the whole document is applied or
+// nothing is. Every member of the room, old or new, ends up assigned to every
+// task of the room that is assigned to everyone.
+func (m RoomModel) Import(roomID int64, tasks []Task, userIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range tasks {
+		if tasks[i].Schedule == "" {
+			tasks[i].Schedule = "daily"
+		}
+		query := `
+			INSERT INTO tasks (title, description, room_id, schedule, due_time, priority, kind, unit, target, position)
+			VALUES ($1, $2, $3, $4, NULLIF($5, '')::time, $6, $7, $8, $9,
+				(SELECT COALESCE(MAX(position), 0) + 1 FROM tasks WHERE room_id = $3))
+			RETURNING id, position`
+		tasks[i].setKindDefaults()
+		args := []interface{}{
+			tasks[i].Title,
+			tasks[i].Description,
+			roomID,
+			tasks[i].Schedule,
+			tasks[i].DueTime,
+			tasks[i].Priority,
+			tasks[i].Kind,
+			tasks[i].Unit,
+			tasks[i].Target,
+		}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&tasks[i].ID, &tasks[i].Position)
+		if err != nil {
+			return err
+		}
+		tasks[i].RoomID = roomID
+
+		for j, item := range tasks[i].Items {
+			query = `
+				INSERT INTO task_items (task_id, title, position)
+				VALUES ($1, $2, $3)`
+			_, err = tx.ExecContext(ctx, query, tasks[i].ID, item.Title, j+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, userID := range userIDs {
+		query := `
+			INSERT INTO rooms_users (user_id, room_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`
+		_, err = tx.ExecContext(ctx, query, userID, roomID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO users_tasks (user_id, task_id, done)
+		SELECT ru.user_id, t.id, false FROM rooms_users ru
+		INNER JOIN tasks t ON t.room_id = ru.room_id AND t.assignment = 'all'
+		WHERE ru.room_id = $1
+		ON CONFLICT DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, roomID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Clone copies a room, its settings and its tasks into a new room owned by
+// userID. When withMembers is set the members of the original room are
+// copied as well, otherwise userID is the only member of the clone. Tasks
+// keep how they are assigned: members of the clone stay in the assignees
+// and rotation pools, a pool left empty goes to userID, and rotating tasks
+// start with the first member of their pool on duty. Members keep their tags
+// on the copied tasks.
+func (m RoomModel) Clone(roomID int64, title string, userID int, withMembers bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var cloneID int64
+	query := `
+		INSERT INTO rooms (title, verification)
+		SELECT $2, verification FROM rooms
+		WHERE id = $1
+		RETURNING id`
+	err = tx.QueryRowContext(ctx, query, roomID, title).Scan(&cloneID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	query = `
+		INSERT INTO rooms_users (user_id, room_id, admin)
+		VALUES ($1, $2, true)`
+	_, err = tx.ExecContext(ctx, query, userID, cloneID)
+	if err != nil {
+		return 0, err
+	}
+	if withMembers {
+		query = `
+			INSERT INTO rooms_users (user_id, room_id)
+			SELECT user_id, $2 FROM rooms_users
+			WHERE room_id = $1
+			ON CONFLICT DO NOTHING`
+		_, err = tx.ExecContext(ctx, query, roomID, cloneID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var taskIDs []int64
+	query = `
+		SELECT id FROM tasks
+		WHERE room_id = $1
+		ORDER BY position, id`
+	rows, err := tx.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		taskIDs = append(taskIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, taskID := range taskIDs {
+		err = cloneTask(ctx, tx, taskID, cloneID, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(cloneID), tx.Commit()
+}
+
+// cloneTask copies a task into the room cloneID, whose members are already
+// in place, and assigns it the way the original is assigned.
+func cloneTask(ctx context.Context, tx *sql.Tx, taskID, cloneID int64, userID int) error {
+	var cloneTaskID int64
+	var assignment string
+	query := `
+		INSERT INTO tasks (title, description, room_id, schedule, due_time, priority, assignment, rotation_policy,
+			kind, unit, target, requires_proof, position)
+		SELECT title, description, $2, schedule, due_time, priority, assignment, rotation_policy,
+			kind, unit, target, requires_proof, position FROM tasks
+		WHERE id = $1
+		RETURNING id, assignment`
+	err := tx.QueryRowContext(ctx, query, taskID, cloneID).Scan(&cloneTaskID, &assignment)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO task_items (task_id, title, position)
+		SELECT $2, title, position FROM task_items
+		WHERE task_id = $1`
+	_, err = tx.ExecContext(ctx, query, taskID, cloneTaskID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO tasks_tags (task_id, tag_id)
+		SELECT $2, tt.tag_id FROM tasks_tags tt
+		INNER JOIN tags tg ON tg.id = tt.tag_id
+		INNER JOIN rooms_users ru ON ru.user_id = tg.user_id AND ru.room_id = $3
+		WHERE tt.task_id = $1`
+	_, err = tx.ExecContext(ctx, query, taskID, cloneTaskID, cloneID)
+	if err != nil {
+		return err
+	}
+
+	if assignment == "all" {
+		query = `
+			INSERT INTO users_tasks (user_id, task_id, done)
+			SELECT user_id, $1, false FROM rooms_users
+			WHERE room_id = $2`
+		_, err = tx.ExecContext(ctx, query, cloneTaskID, cloneID)
+		return err
+	}
+
+	query = `
+		INSERT INTO task_assignees (task_id, user_id)
+		SELECT $2, ta.user_id FROM task_assignees ta
+		INNER JOIN rooms_users ru ON ru.user_id = ta.user_id AND ru.room_id = $3
+		WHERE ta.task_id = $1`
+	result, err := tx.ExecContext(ctx, query, taskID, cloneTaskID, cloneID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		query = `
+			INSERT INTO task_assignees (task_id, user_id)
+			VALUES ($1, $2)`
+		_, err = tx.ExecContext(ctx, query, cloneTaskID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if assignment == "rotate" {
+		query = `
+			WITH holder AS (
+				SELECT MIN(user_id) AS user_id FROM task_assignees
+				WHERE task_id = $1
+			), duty AS (
+				INSERT INTO task_duties (task_id, user_id)
+				SELECT $1, user_id FROM holder
+			)
+			INSERT INTO users_tasks (user_id, task_id, done)
+			SELECT user_id, $1, false FROM holder`
+	} else {
+		query = `
+			INSERT INTO users_tasks (user_id, task_id, done)
+			SELECT user_id, $1, false FROM task_assignees
+			WHERE task_id = $1`
+	}
+	_, err = tx.ExecContext(ctx, query, cloneTaskID)
+	return err
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// assignedUsers returns the users each task of a room is assigned to, keyed
+// by task title.
+func assignedUsers(t *testing.T, db *sql.DB, roomID int64) map[string][]int {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT t.title, ut.user_id FROM users_tasks ut
+		INNER JOIN tasks t ON t.id = ut.task_id
+		WHERE t.room_id = $1
+		ORDER BY t.title, ut.user_id`, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	assigned := make(map[string][]int)
+	for rows.Next() {
+		var title string
+		var userID int
+		err = rows.Scan(&title, &userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assigned[title] = append(assigned[title], userID)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return assigned
+}
+
+func TestClone(t *testing.T) {
+	db := newTestDB(t)
+	m := RoomModel{DB: db}
+	owner, b, c := insertUser(t, db, "owner"), insertUser(t, db, "b"), insertUser(t, db, "c")
+	roomID := insertRoom(t, db, "flat", true, owner, b, c)
+
+	insertTask := func(title, assignment string, pool ...int) int64 {
+		taskID := insertID(t, db, `
+			INSERT INTO tasks (title, room_id, assignment, rotation_policy)
+			VALUES ($1, $2, $3, 'least-recently-done')
+			RETURNING id`, title, roomID, assignment)
+		for _, userID := range pool {
+			exec(t, db, `INSERT INTO task_assignees (task_id, user_id) VALUES ($1, $2)`, taskID, userID)
+		}
+		return taskID
+	}
+	everyone := insertTask("everyone", "all")
+	insertTask("pair", "selected", b, c)
+	insertTask("dishes", "rotate", b, c)
+	insertTask("solo", "selected", c)
+	tagID := insertID(t, db, `INSERT INTO tags (user_id, name) VALUES ($1, 'home') RETURNING id`, b)
+	exec(t, db, `INSERT INTO tasks_tags (task_id, tag_id) VALUES ($1, $2)`, everyone, tagID)
+
+	tests := []struct {
+		name        string
+		withMembers bool
+		assigned    map[string][]int
+		tagged      int
+	}{
+		{
+			name:        "with members",
+			withMembers: true,
+			assigned: map[string][]int{
+				"dishes":   {b},
+				"everyone": {owner, b, c},
+				"pair":     {b, c},
+				"solo":     {c},
+			},
+			tagged: 1,
+		},
+		{
+			name: "alone",
+			assigned: map[string][]int{
+				"dishes":   {owner},
+				"everyone": {owner},
+				"pair":     {owner},
+				"solo":     {owner},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloneID, err := m.Clone(roomID, "copy", owner, tt.withMembers)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var verification bool
+			err = db.QueryRow(`SELECT verification FROM rooms WHERE id = $1`, cloneID).Scan(&verification)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verification {
+				t.Error("the clone lost peer verification")
+			}
+
+			var copied int
+			err = db.QueryRow(`
+				SELECT COUNT(*) FROM tasks
+				WHERE room_id = $1 AND rotation_policy = 'least-recently-done'
+				AND assignment = CASE title WHEN 'everyone' THEN 'all' WHEN 'dishes' THEN 'rotate' ELSE 'selected' END`,
+				cloneID).Scan(&copied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if copied != 4 {
+				t.Errorf("%d of 4 tasks kept their assignment", copied)
+			}
+
+			if got := assignedUsers(t, db, int64(cloneID)); !reflect.DeepEqual(got, tt.assigned) {
+				t.Errorf("assigned = %v, want %v", got, tt.assigned)
+			}
+
+			var onDuty []int
+			rows, err := db.Query(`
+				SELECT d.user_id FROM task_duties d
+				INNER JOIN tasks t ON t.id = d.task_id
+				WHERE t.room_id = $1 AND d.ended_at IS NULL`, cloneID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var userID int
+				if err := rows.Scan(&userID); err != nil {
+					t.Fatal(err)
+				}
+				onDuty = append(onDuty, userID)
+			}
+			rows.Close()
+			if want := tt.assigned["dishes"]; !reflect.DeepEqual(onDuty, want) {
+				t.Errorf("on duty = %v, want %v", onDuty, want)
+			}
+
+			var tagged int
+			err = db.QueryRow(`
+				SELECT COUNT(*) FROM tasks_tags tt
+				INNER JOIN tasks t ON t.id = tt.task_id
+				WHERE t.room_id = $1`, cloneID).Scan(&tagged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tagged != tt.tagged {
+				t.Errorf("%d tags were copied, want %d", tagged, tt.tagged)
+			}
+		})
+	}
+
+	if _, err := m.Clone(0, "missing", owner, false); err != ErrRecordNotFound {
+		t.Errorf("cloning a missing room returned %v", err)
+	}
+}
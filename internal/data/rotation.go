@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// RotationPolicies lists the ways a rotating task picks the next member on
+// duty:
+//
+//   - round-robin: the next member of the pool in user ID order;
+//   - least-recently-done: the member who has gone longest without
+//     completing the task, members who never did it first;
+//   - random-fair: a random member among those with the fewest duties.
+var RotationPolicies = []string{"round-robin", "least-recently-done", "random-fair"}
+
+// Duty is one period during which a member was responsible for a rotating
+// task. EndedAt is zero for the current period.
+type Duty struct {
+	ID        int64     `json:"id"`
+	TaskID    int64     `json:"task_id"`
+	UserID    int       `json:"user_id"`
+	User      string    `json:"user"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitempty"`
+	Done      bool      `json:"done"`
+}
+
+// dutyCandidate is a member of a rotation pool with their duty record for
+// the task.
+type dutyCandidate struct {
+	UserID   int
+	LastDone time.Time
+	Duties   int
+}
+
+// nextOnDuty picks the member that takes over a rotating task from current
+// according to policy. It returns 0 for an empty pool.
+func nextOnDuty(policy string, candidates []dutyCandidate, current int) int {
+	if len(candidates) == 0 {
+		return 0
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].UserID < candidates[j].UserID
+	})
+
+	switch policy {
+	case "least-recently-done":
+		next := candidates[0]
+		for _, c := range candidates[1:] {
+			if c.LastDone.Before(next.LastDone) || (c.LastDone.Equal(next.LastDone) && next.UserID == current) {
+				next = c
+			}
+		}
+		return next.UserID
+	case "random-fair":
+		fewest := candidates[0].Duties
+		for _, c := range candidates {
+			if c.Duties < fewest {
+				fewest = c.Duties
+			}
+		}
+		var pool []int
+		for _, c := range candidates {
+			if c.Duties == fewest && (c.UserID != current || len(candidates) == 1) {
+				pool = append(pool, c.UserID)
+			}
+		}
+		if len(pool) == 0 {
+			for _, c := range candidates {
+				if c.UserID != current {
+					pool = append(pool, c.UserID)
+				}
+			}
+		}
+		return pool[rand.Intn(len(pool))]
+	default:
+		for _, c := range candidates {
+			if c.UserID > current {
+				return c.UserID
+			}
+		}
+		return candidates[0].UserID
+	}
+}
+
+// rotate closes the current duty of a rotating task, recording whether it was
+// completed, and hands the task to the next member chosen by policy.
+func (m TaskModel) rotate(ctx context.Context, taskID int64, policy string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	var done bool
+	query := `
+		SELECT user_id, done FROM users_tasks
+		WHERE task_id = $1
+		ORDER BY user_id
+		LIMIT 1`
+	err = tx.QueryRowContext(ctx, query, taskID).Scan(&current, &done)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	query = `
+		UPDATE task_duties
+		SET ended_at = NOW(), done = $2
+		WHERE task_id = $1 AND ended_at IS NULL`
+	_, err = tx.ExecContext(ctx, query, taskID, done)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		SELECT ta.user_id,
+			COALESCE(MAX(td.started_at) FILTER (WHERE td.done), 'epoch'),
+			COUNT(td.id)
+		FROM task_assignees ta
+		LEFT JOIN task_duties td ON td.task_id = ta.task_id AND td.user_id = ta.user_id
+		WHERE ta.task_id = $1
+		GROUP BY ta.user_id`
+	rows, err := tx.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return err
+	}
+	var candidates []dutyCandidate
+	for rows.Next() {
+		var c dutyCandidate
+		err = rows.Scan(&c.UserID, &c.LastDone, &c.Duties)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM users_tasks
+		WHERE task_id = $1`
+	_, err = tx.ExecContext(ctx, query, taskID)
+	if err != nil {
+		return err
+	}
+
+	next := nextOnDuty(policy, candidates, current)
+	if next != 0 {
+		query = `
+			INSERT INTO users_tasks (user_id, task_id, done)
+			VALUES ($1, $2, false)`
+		_, err = tx.ExecContext(ctx, query, next, taskID)
+		if err != nil {
+			return err
+		}
+		query = `
+			INSERT INTO task_duties (task_id, user_id)
+			VALUES ($1, $2)`
+		_, err = tx.ExecContext(ctx, query, taskID, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDuties returns the most recent duty periods of a task, newest first.
+func (m TaskModel) GetDuties(taskID int64, limit int) ([]Duty, error) {
+	query := `
+		SELECT td.id, td.task_id, td.user_id, u.name, td.started_at, td.ended_at, td.done
+		FROM task_duties td
+		INNER JOIN users u ON u.id = td.user_id
+		WHERE td.task_id = $1
+		ORDER BY td.started_at DESC, td.id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duties []Duty
+	for rows.Next() {
+		var duty Duty
+		var endedAt sql.NullTime
+		err = rows.Scan(&duty.ID, &duty.TaskID, &duty.UserID, &duty.User, &duty.StartedAt, &endedAt, &duty.Done)
+		if err != nil {
+			return nil, err
+		}
+		duty.EndedAt = endedAt.Time
+		duties = append(duties, duty)
+	}
+	return duties, rows.Err()
+}
@@ -0,0 +1,302 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// StatsDays is the number of days covered by the room statistics, today
+// included.
+const StatsDays = 30
+
+// Completion counts how many of the task assignments in a period were done.
+type Completion struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Percent returns the share of done assignments, rounded down to a whole
+// percent. An empty period counts as zero.
+func (c Completion) Percent() int {
+	if c.Total == 0 {
+		return 0
+	}
+	return c.Done * 100 / c.Total
+}
+
+func (c *Completion) add(done, total int) {
+	c.Done += done
+	c.Total += total
+}
+
+// MemberStats holds the completion figures of one room member.
+type MemberStats struct {
+	User       User       `json:"user"`
+	Day        Completion `json:"day"`
+	Week       Completion `json:"week"`
+	Month      Completion `json:"month"`
+	BestStreak int        `json:"best_streak"`
+}
+
+// TaskStats holds the completion rate of one task over the last StatsDays
+// days.
+type TaskStats struct {
+	TaskID int64      `json:"task_id"`
+	Title  string     `json:"title"`
+	Month  Completion `json:"month"`
+}
+
+// RoomStats is everything shown on the statistics page of a room. Members are
+// ordered as a leaderboard and Daily holds the room wide completion of each
+// of the last StatsDays days, oldest first.
+type RoomStats struct {
+	Members []MemberStats `json:"members"`
+	Tasks   []TaskStats   `json:"tasks"`
+	Daily   []Completion  `json:"daily"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// RecordHistory stores the done state of every assignment that is about to be
+// reset under day, the day whose period the reset closes. Today's live state
+// comes from users_tasks. A day that is already recorded is kept as it is,
+// so running the reset twice cannot overwrite it with the cleared state.
+func (m StatsModel) RecordHistory(day time.Time) error {
+	query := `
+		INSERT INTO task_history (user_id, task_id, room_id, day, done)
+		SELECT ut.user_id, ut.task_id, t.room_id, $1::date, ut.done
+		FROM users_tasks ut
+		INNER JOIN tasks t ON t.id = ut.task_id
+		WHERE t.schedule = 'daily' OR (t.schedule = 'weekly' AND EXTRACT(ISODOW FROM NOW()) = 1)
+		ON CONFLICT (user_id, task_id, day) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, day.Format("2006-01-02"))
+	return err
+}
+
+// GetRoomStats computes the statistics of a room for the given members from
+// the recorded history and the current state of the room's tasks.
+func (m StatsModel) GetRoomStats(roomID int64, members []User) (*RoomStats, error) {
+	query := `
+		SELECT e.user_id, CURRENT_DATE - e.day, COUNT(*), COUNT(*) FILTER (WHERE e.done)
+		FROM (
+			SELECT user_id, day, done FROM task_history
+			WHERE room_id = $1 AND day > CURRENT_DATE - 366
+			UNION ALL
+			SELECT ut.user_id, CURRENT_DATE, ut.done FROM users_tasks ut
+			INNER JOIN tasks t ON t.id = ut.task_id AND t.room_id = $1
+		) e
+		GROUP BY e.user_id, e.day
+		ORDER BY e.user_id, e.day DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &RoomStats{Daily: make([]Completion, StatsDays)}
+	byUser := make(map[int]*MemberStats)
+	for _, user := range members {
+		byUser[user.ID] = &MemberStats{User: user}
+	}
+	// Days are read newest first, so a streak continues as long as every day
+	// is exactly one day older than the previous one and fully done.
+	streaks := make(map[int]struct{ age, length int })
+	for rows.Next() {
+		var userID, age, total, done int
+		err = rows.Scan(&userID, &age, &total, &done)
+		if err != nil {
+			return nil, err
+		}
+		// Completions of users who left the room or deleted their account
+		// still count for the room as a whole.
+		if age < StatsDays {
+			stats.Daily[StatsDays-1-age].add(done, total)
+		}
+		member, ok := byUser[userID]
+		if !ok {
+			continue
+		}
+		if age < StatsDays {
+			member.Month.add(done, total)
+		}
+		if age < 7 {
+			member.Week.add(done, total)
+		}
+		if age == 0 {
+			member.Day.add(done, total)
+		}
+
+		streak := streaks[userID]
+		switch {
+		case done < total:
+			streak.length = 0
+		case streak.length > 0 && age == streak.age+1:
+			streak.length++
+		default:
+			streak.length = 1
+		}
+		streak.age = age
+		streaks[userID] = streak
+		if streak.length > member.BestStreak {
+			member.BestStreak = streak.length
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, user := range members {
+		stats.Members = append(stats.Members, *byUser[user.ID])
+	}
+	sort.SliceStable(stats.Members, func(i, j int) bool {
+		a, b := stats.Members[i], stats.Members[j]
+		if a.Month.Done != b.Month.Done {
+			return a.Month.Done > b.Month.Done
+		}
+		if a.Month.Percent() != b.Month.Percent() {
+			return a.Month.Percent() > b.Month.Percent()
+		}
+		return a.BestStreak > b.BestStreak
+	})
+
+	stats.Tasks, err = m.getTaskStats(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetCurrentStreaks returns, per room of the user, the number of days in a
+// row up to yesterday on which the user finished all of their tasks. Rooms
+// without a running streak are left out.
+func (m StatsModel) GetCurrentStreaks(userID int) (map[int64]int, error) {
+	query := `
+		SELECT h.room_id, CURRENT_DATE - h.day, bool_and(h.done)
+		FROM task_history h
+		INNER JOIN rooms_users ru ON ru.room_id = h.room_id AND ru.user_id = h.user_id
+		WHERE h.user_id = $1 AND h.day > CURRENT_DATE - 366 AND h.day < CURRENT_DATE
+		GROUP BY h.room_id, h.day
+		ORDER BY h.room_id, h.day DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// A streak only counts while the days read so far, newest first, are
+	// yesterday, the day before and so on, all of them fully done.
+	streaks := make(map[int64]int)
+	broken := make(map[int64]bool)
+	for rows.Next() {
+		var roomID int64
+		var age int
+		var done bool
+		err = rows.Scan(&roomID, &age, &done)
+		if err != nil {
+			return nil, err
+		}
+		if broken[roomID] {
+			continue
+		}
+		if !done || age != streaks[roomID]+1 {
+			broken[roomID] = true
+			continue
+		}
+		streaks[roomID]++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return streaks, nil
+}
+
+func (m StatsModel) getTaskStats(ctx context.Context, roomID int64) ([]TaskStats, error) {
+	query := `
+		SELECT t.id, t.title, COUNT(e.task_id), COUNT(e.task_id) FILTER (WHERE e.done)
+		FROM tasks t
+		LEFT JOIN (
+			SELECT task_id, done FROM task_history
+			WHERE room_id = $1 AND day > CURRENT_DATE - $2::integer
+			UNION ALL
+			SELECT task_id, done FROM users_tasks
+			WHERE task_id IN (SELECT id FROM tasks WHERE room_id = $1)
+		) e ON e.task_id = t.id
+		WHERE t.room_id = $1
+		GROUP BY t.id, t.title, t.position
+		ORDER BY t.position, t.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, StatsDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TaskStats
+	for rows.Next() {
+		var task TaskStats
+		err = rows.Scan(&task.TaskID, &task.Title, &task.Month.Total, &task.Month.Done)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// HistoryEntry is the recorded state of one of the user's tasks on a day.
+type HistoryEntry struct {
+	Day    string `json:"day"`
+	TaskID int64  `json:"task_id"`
+	Task   string `json:"task"`
+	RoomID int64  `json:"room_id"`
+	Room   string `json:"room"`
+	Done   bool   `json:"done"`
+}
+
+// GetHistoryByUser returns all recorded days of the user's tasks, newest
+// first.
+func (m StatsModel) GetHistoryByUser(userID int) ([]HistoryEntry, error) {
+	query := `
+		SELECT to_char(h.day, 'YYYY-MM-DD'), h.task_id, t.title, h.room_id, r.title, h.done
+		FROM task_history h
+		INNER JOIN tasks t ON t.id = h.task_id
+		INNER JOIN rooms r ON r.id = h.room_id
+		WHERE h.user_id = $1
+		ORDER BY h.day DESC, r.title, t.position, t.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		err = rows.Scan(&entry.Day, &entry.TaskID, &entry.Task, &entry.RoomID, &entry.Room, &entry.Done)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
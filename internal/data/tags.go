@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Tag is a label a user puts on tasks. Tags are private to the user that
+// created them, so two members of a room can tag the same task differently.
+type Tag struct {
+	ID     int64  `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// AddToTask labels a task with the named tag, creating the tag first if the
+// user does not have one with that name yet.
+func (m TagModel) AddToTask(userID int, taskID int64, name string) error {
+	query := `
+		WITH tag AS (
+			INSERT INTO tags (user_id, name)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		)
+		INSERT INTO tasks_tags (task_id, tag_id)
+		SELECT $3, id FROM tag
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, name, taskID)
+	return err
+}
+
+func (m TagModel) RemoveFromTask(userID int, taskID int64, name string) error {
+	query := `
+		DELETE FROM tasks_tags
+		WHERE task_id = $1 AND tag_id = (SELECT id FROM tags WHERE user_id = $2 AND name = $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, taskID, userID, name)
+	return err
+}
+
+// GetAllForUser returns the tags of the user that are in use on at least one
+// task, ordered by name.
+func (m TagModel) GetAllForUser(userID int) ([]Tag, error) {
+	query := `
+		SELECT id, user_id, name FROM tags tg
+		WHERE user_id = $1 AND EXISTS (SELECT 1 FROM tasks_tags tt WHERE tt.tag_id = tg.id)
+		ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		err = rows.Scan(&tag.ID, &tag.UserID, &tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
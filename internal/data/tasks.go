@@ -4,31 +4,115 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"github.com/lib/pq"
 	"time"
 )
 
 type Task struct {
-	ID     int64  `json:"id"`
-	Title  string `json:"title"`
-	RoomID int64  `json:"room_id"`
-	Done   bool   `json:"done"`
+	ID            int64  `json:"id"`
+	Title         string `json:"title"`
+	Description   string `json:"description,omitempty"`
+	RoomID        int64  `json:"room_id"`
+	Schedule      string `json:"schedule"`
+	DueTime       string `json:"due_time,omitempty"`
+	Priority      int    `json:"priority"`
+	Position      int    `json:"position"`
+	Assignment    string `json:"assignment"`
+	Rotation      string `json:"rotation_policy,omitempty"`
+	Kind          string `json:"kind"`
+	Unit          string `json:"unit,omitempty"`
+	Target        int    `json:"target"`
+	Progress      int    `json:"progress"`
+	Done          bool   `json:"done"`
+	Review        string `json:"review,omitempty"`
+	RequiresProof bool   `json:"requires_proof"`
+
+	Items      []TaskItem `json:"items,omitempty"`
+	ItemsDone  int        `json:"-"`
+	ItemsTotal int        `json:"-"`
+	ProofID    int64      `json:"-"`
+	RoomTitle  string     `json:"-"`
+	Tags       []string   `json:"tags,omitempty"`
+}
+
+// TaskFilters narrows down the tasks returned by UserModel.GetTasksByUser.
+// Zero values disable the corresponding filter.
+type TaskFilters struct {
+	RoomID    int64
+	Tag       string
+	Done      string // "done" or "pending"
+	DueBefore string // "15:04"
+}
+
+// TaskPriorities names the priority levels, indexed by Task.Priority.
+var TaskPriorities = []string{"none", "low", "medium", "high"}
+
+// PriorityName returns the human readable priority of the task.
+func (t Task) PriorityName() string {
+	if t.Priority < 0 || t.Priority >= len(TaskPriorities) {
+		return TaskPriorities[0]
+	}
+	return TaskPriorities[t.Priority]
 }
 
+// TaskAssignments lists the ways a task can be assigned to room members:
+// everyone, a fixed subset of members, or one member of a subset at a time,
+// moving on to the next one on every reset.
+var TaskAssignments = []string{"all", "selected", "rotate"}
+
+// TaskKinds lists the types of task. A "check" task is done with a single
+// tick, a "count" task once the member's progress reaches its target, e.g.
+// 8 glasses of water.
+var TaskKinds = []string{"check", "count"}
+
+// Quantitative reports whether progress on the task is counted towards a
+// target rather than ticked off.
+func (t Task) Quantitative() bool {
+	return t.Kind == "count"
+}
+
+// TaskSchedules lists the reset periods a task can have. Daily tasks are
+// reset by every run of ResetAllTasks, weekly ones only on Mondays.
+var TaskSchedules = []string{"daily", "weekly"}
+
 type TaskModel struct {
 	DB *sql.DB
 }
 
 func (m TaskModel) Insert(task *Task) (int, error) {
 	query := `
-			INSERT INTO tasks (title, room_id)
-			VALUES ($1, $2)
-			RETURNING id`
-	args := []interface{}{task.Title, task.RoomID}
+			INSERT INTO tasks (title, description, room_id, schedule, due_time, priority, assignment, rotation_policy, kind, unit, target, position)
+			VALUES ($1, $2, $3, $4, NULLIF($5, '')::time, $6, $7, $8, $9, $10, $11,
+				(SELECT COALESCE(MAX(position), 0) + 1 FROM tasks WHERE room_id = $3))
+			RETURNING id, position`
+	if task.Schedule == "" {
+		task.Schedule = "daily"
+	}
+	if task.Assignment == "" {
+		task.Assignment = "all"
+	}
+	if task.Rotation == "" {
+		task.Rotation = "round-robin"
+	}
+	task.setKindDefaults()
+	args := []interface{}{
+		task.Title,
+		task.Description,
+		task.RoomID,
+		task.Schedule,
+		task.DueTime,
+		task.Priority,
+		task.Assignment,
+		task.Rotation,
+		task.Kind,
+		task.Unit,
+		task.Target,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&task.ID)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&task.ID, &task.Position)
 	if err != nil {
 		return 0, err
 	}
@@ -36,7 +120,8 @@ func (m TaskModel) Insert(task *Task) (int, error) {
 }
 func (m TaskModel) GetByID(id int64) (*Task, error) {
 	query := `
-			SELECT id, title, room_id 
+			SELECT id, title, description, room_id, schedule, COALESCE(to_char(due_time, 'HH24:MI'), ''), priority, position, assignment, rotation_policy,
+				kind, unit, target, requires_proof
 			FROM tasks
 			WHERE id = $1`
 	var task Task
@@ -47,7 +132,18 @@ func (m TaskModel) GetByID(id int64) (*Task, error) {
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&task.ID,
 		&task.Title,
+		&task.Description,
 		&task.RoomID,
+		&task.Schedule,
+		&task.DueTime,
+		&task.Priority,
+		&task.Position,
+		&task.Assignment,
+		&task.Rotation,
+		&task.Kind,
+		&task.Unit,
+		&task.Target,
+		&task.RequiresProof,
 	)
 	if err != nil {
 		switch {
@@ -64,34 +160,47 @@ func (m TaskModel) GetByID(id int64) (*Task, error) {
 func (m TaskModel) Update(task *Task) error {
 	query := `
 		UPDATE tasks
-		SET title = $1, room_id = $2
-		WHERE id = $3`
+		SET title = $1, description = $2, room_id = $3, schedule = $4, due_time = NULLIF($5, '')::time, priority = $6,
+			kind = $7, unit = $8, target = $9
+		WHERE id = $10`
 
+	task.setKindDefaults()
 	args := []interface{}{
 		task.Title,
+		task.Description,
 		task.RoomID,
+		task.Schedule,
+		task.DueTime,
+		task.Priority,
+		task.Kind,
+		task.Unit,
+		task.Target,
 		task.ID,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan()
+	result, err := m.DB.ExecContext(ctx, query, args...)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
-		default:
-			return err
-		}
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEditConflict
 	}
 	return nil
 }
 
 func (m TaskModel) GetByRoomID(id int64) ([]Task, error) {
 	query := `
-			SELECT id, title, room_id 
+			SELECT id, title, description, room_id, schedule, COALESCE(to_char(due_time, 'HH24:MI'), ''), priority, position, assignment,
+				kind, unit, target, requires_proof
 			FROM tasks
-			WHERE room_id = $1`
+			WHERE room_id = $1
+			ORDER BY position, id`
 	var tasks []Task
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -109,7 +218,8 @@ func (m TaskModel) GetByRoomID(id int64) ([]Task, error) {
 	}
 	for rows.Next() {
 		var task Task
-		err = rows.Scan(&task.ID, &task.Title, &task.RoomID)
+		err = rows.Scan(&task.ID, &task.Title, &task.Description, &task.RoomID, &task.Schedule, &task.DueTime, &task.Priority, &task.Position, &task.Assignment,
+			&task.Kind, &task.Unit, &task.Target, &task.RequiresProof)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
@@ -124,9 +234,312 @@ func (m TaskModel) GetByRoomID(id int64) ([]Task, error) {
 	return tasks, nil
 }
 
+// Reorder stores the given order of a room's tasks. Task IDs that do not
+// belong to the room are ignored, tasks missing from the list keep their
+// relative order after the listed ones.
+func (m TaskModel) Reorder(roomID int64, taskIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tasks
+		SET position = position + $2
+		WHERE room_id = $1`
+	_, err = tx.ExecContext(ctx, query, roomID, len(taskIDs))
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE tasks
+		SET position = $3
+		WHERE id = $1 AND room_id = $2`
+	for i, id := range taskIDs {
+		_, err = tx.ExecContext(ctx, query, id, roomID, i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAssignees returns the IDs of the members a task is limited to, or the
+// rotation pool for rotating tasks. Tasks assigned to everyone have none.
+func (m TaskModel) GetAssignees(taskID int64) ([]int, error) {
+	query := `
+		SELECT user_id FROM task_assignees
+		WHERE task_id = $1
+		ORDER BY user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+// SetAssignees changes how a task is assigned and adds or removes the
+// users_tasks rows to match. Users that are not members of the task's room
+// are ignored; when none of them is a member, ErrNoAssignees is returned
+// and nothing changes. A rotating task keeps its current holder when they
+// are still in the pool; duty periods are opened and closed to match.
+func (m TaskModel) SetAssignees(task *Task, userIDs []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if task.Rotation == "" {
+		task.Rotation = "round-robin"
+	}
+	query := `
+		UPDATE tasks
+		SET assignment = $2, rotation_policy = $3
+		WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, task.ID, task.Assignment, task.Rotation)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM task_assignees
+		WHERE task_id = $1`
+	_, err = tx.ExecContext(ctx, query, task.ID)
+	if err != nil {
+		return err
+	}
+	if task.Assignment != "all" {
+		query = `
+			INSERT INTO task_assignees (task_id, user_id)
+			SELECT $1, user_id FROM rooms_users
+			WHERE room_id = $2 AND user_id = ANY($3)`
+		result, err := tx.ExecContext(ctx, query, task.ID, task.RoomID, pq.Array(userIDs))
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNoAssignees
+		}
+	}
+
+	switch task.Assignment {
+	case "all":
+		query = `
+			INSERT INTO users_tasks (user_id, task_id, done)
+			SELECT user_id, $1, false FROM rooms_users
+			WHERE room_id = $2
+			ON CONFLICT DO NOTHING`
+		_, err = tx.ExecContext(ctx, query, task.ID, task.RoomID)
+		if err != nil {
+			return err
+		}
+	case "selected":
+		query = `
+			DELETE FROM users_tasks
+			WHERE task_id = $1 AND user_id NOT IN (SELECT user_id FROM task_assignees WHERE task_id = $1)`
+		_, err = tx.ExecContext(ctx, query, task.ID)
+		if err != nil {
+			return err
+		}
+		query = `
+			INSERT INTO users_tasks (user_id, task_id, done)
+			SELECT user_id, $1, false FROM task_assignees
+			WHERE task_id = $1
+			ON CONFLICT DO NOTHING`
+		_, err = tx.ExecContext(ctx, query, task.ID)
+		if err != nil {
+			return err
+		}
+	case "rotate":
+		var holder int
+		query = `
+			SELECT COALESCE(
+				(SELECT ut.user_id FROM users_tasks ut
+					INNER JOIN task_assignees ta ON ta.task_id = ut.task_id AND ta.user_id = ut.user_id
+					WHERE ut.task_id = $1
+					ORDER BY ut.user_id LIMIT 1),
+				(SELECT MIN(user_id) FROM task_assignees WHERE task_id = $1),
+				0)`
+		err = tx.QueryRowContext(ctx, query, task.ID).Scan(&holder)
+		if err != nil {
+			return err
+		}
+		query = `
+			DELETE FROM users_tasks
+			WHERE task_id = $1 AND user_id <> $2`
+		_, err = tx.ExecContext(ctx, query, task.ID, holder)
+		if err != nil {
+			return err
+		}
+		if holder != 0 {
+			query = `
+				INSERT INTO users_tasks (user_id, task_id, done)
+				VALUES ($1, $2, false)
+				ON CONFLICT DO NOTHING`
+			_, err = tx.ExecContext(ctx, query, holder, task.ID)
+			if err != nil {
+				return err
+			}
+		}
+		query = `
+			UPDATE task_duties
+			SET ended_at = NOW()
+			WHERE task_id = $1 AND ended_at IS NULL AND user_id <> $2`
+		_, err = tx.ExecContext(ctx, query, task.ID, holder)
+		if err != nil {
+			return err
+		}
+		if holder != 0 {
+			query = `
+				INSERT INTO task_duties (task_id, user_id)
+				SELECT $1, $2
+				WHERE NOT EXISTS (SELECT 1 FROM task_duties WHERE task_id = $1 AND ended_at IS NULL)`
+			_, err = tx.ExecContext(ctx, query, task.ID, holder)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if task.Assignment != "rotate" {
+		query = `
+			UPDATE task_duties
+			SET ended_at = NOW()
+			WHERE task_id = $1 AND ended_at IS NULL`
+		_, err = tx.ExecContext(ctx, query, task.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RotateAssignments hands every rotating task that is due for a reset to the
+// next member of its pool, as chosen by the task's rotation policy.
+func (m TaskModel) RotateAssignments() error {
+	query := `
+		SELECT id, rotation_policy FROM tasks
+		WHERE assignment = 'rotate'
+		AND (schedule = 'daily' OR (schedule = 'weekly' AND EXTRACT(ISODOW FROM NOW()) = 1))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	var tasks []Task
+	for rows.Next() {
+		var task Task
+		err = rows.Scan(&task.ID, &task.Rotation)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		err = m.rotate(ctx, task.ID, task.Rotation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setKindDefaults fills in the kind and target of tasks created without
+// them. Check tasks always have a target of one tick and no unit.
+func (t *Task) setKindDefaults() {
+	if t.Kind != "count" {
+		t.Kind = "check"
+		t.Unit = ""
+		t.Target = 1
+	}
+	if t.Target < 1 {
+		t.Target = 1
+	}
+}
+
+// AddProgress adds amount to the user's progress on a task, never going below
+// zero, and marks the task done for the user once the target is reached and,
+// for tasks that require proof, a photo has been attached.
+func (m TaskModel) AddProgress(userID int, taskID int64, amount int) (*Task, error) {
+	query := `
+		UPDATE users_tasks ut
+		SET progress = GREATEST(ut.progress + $3, 0),
+			done = GREATEST(ut.progress + $3, 0) >= t.target AND (NOT r.verification OR ut.review = 'approved')
+				AND (NOT t.requires_proof OR ut.proof_id IS NOT NULL),
+			review = CASE WHEN GREATEST(ut.progress + $3, 0) >= t.target THEN ut.review ELSE '' END
+		FROM tasks t
+		INNER JOIN rooms r ON r.id = t.room_id
+		WHERE t.id = ut.task_id AND ut.user_id = $1 AND ut.task_id = $2
+		RETURNING t.id, t.title, t.room_id, t.target, ut.progress, ut.done, ut.review, t.requires_proof,
+			COALESCE(ut.proof_id, 0)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var task Task
+	err := m.DB.QueryRowContext(ctx, query, userID, taskID, amount).Scan(
+		&task.ID,
+		&task.Title,
+		&task.RoomID,
+		&task.Target,
+		&task.Progress,
+		&task.Done,
+		&task.Review,
+		&task.RequiresProof,
+		&task.ProofID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &task, nil
+}
+
 func (m TaskModel) UpdateUserTaskByBothIDFalse(userID int, taskID int) error {
 	query := `UPDATE users_tasks
-			SET done = false
+			SET done = false, proof_id = NULL, review = ''
 			WHERE user_id = $1 and task_id = $2`
 	args := []interface{}{
 		userID,
@@ -173,14 +586,29 @@ func (m TaskModel) UpdateUserTaskByBothIDTrue(userID int, taskID int) error {
 }
 
 func (m TaskModel) ResetAllTasks() error {
+	return m.resetTasks(0)
+}
+
+// ResetRoomTasks is ResetAllTasks for the tasks of one room.
+func (m TaskModel) ResetRoomTasks(roomID int64) error {
+	return m.resetTasks(roomID)
+}
+
+// resetTasks clears the done state of the tasks due for a reset, in the
+// given room or in all rooms when roomID is zero.
+func (m TaskModel) resetTasks(roomID int64) error {
 	query := `
 		UPDATE users_tasks
-			SET done = false`
+			SET done = false, progress = 0, proof_id = NULL, review = ''
+			WHERE task_id IN (
+				SELECT id FROM tasks
+				WHERE ($1 = 0 OR room_id = $1)
+				AND (schedule = 'daily' OR (schedule = 'weekly' AND EXTRACT(ISODOW FROM NOW()) = 1)))`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query)
+	_, err := m.DB.ExecContext(ctx, query, roomID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -189,5 +617,95 @@ func (m TaskModel) ResetAllTasks() error {
 			return err
 		}
 	}
+
+	query = `
+		UPDATE users_task_items
+			SET done = false
+			WHERE item_id IN (
+				SELECT ti.id FROM task_items ti
+				INNER JOIN tasks t ON t.id = ti.task_id
+				WHERE ($1 = 0 OR t.room_id = $1)
+				AND (t.schedule = 'daily' OR (t.schedule = 'weekly' AND EXTRACT(ISODOW FROM NOW()) = 1)))`
+	_, err = m.DB.ExecContext(ctx, query, roomID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetRequiresProof updates which tasks of a room can only be marked done with
+// a photo attached. Tasks of the room that are not listed no longer require
+// one.
+func (m TaskModel) SetRequiresProof(roomID int64, taskIDs []int64) error {
+	query := `
+		UPDATE tasks SET requires_proof = (id = ANY($2))
+		WHERE room_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, roomID, pq.Array(taskIDs))
+	return err
+}
+
+// Review states of a completion in a room with peer verification.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// RequestReview turns the user's completion of a task into a pending one that
+// only counts as done once another member approves it.
+func (m TaskModel) RequestReview(userID int, taskID int64) error {
+	query := `
+		UPDATE users_tasks SET done = false, review = $3, reviewed_by = NULL
+		WHERE user_id = $1 AND task_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, taskID, ReviewPending)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Review approves or rejects a pending completion. Members cannot review
+// their own completions, and completions that are not pending are reported
+// as not found.
+func (m TaskModel) Review(userID int, taskID int64, reviewerID int, approve bool) error {
+	query := `
+		UPDATE users_tasks SET done = $4, review = $5, reviewed_by = $3
+		WHERE user_id = $1 AND task_id = $2 AND user_id <> $3 AND review = $6`
+
+	review := ReviewRejected
+	if approve {
+		review = ReviewApproved
+	}
+	args := []interface{}{userID, taskID, reviewerID, approve, review, ReviewPending}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
 	return nil
 }
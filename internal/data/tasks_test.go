@@ -0,0 +1,40 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetAssigneesOutsiders(t *testing.T) {
+	db := newTestDB(t)
+	m := TaskModel{DB: db}
+	a, b, outsider := insertUser(t, db, "a"), insertUser(t, db, "b"), insertUser(t, db, "outsider")
+	roomID := insertRoom(t, db, "room", false, a, b)
+	task := &Task{Title: "task", RoomID: roomID}
+	_, err := m.Insert(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Assignment = "all"
+	err = m.SetAssignees(task, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task.Assignment = "selected"
+	err = m.SetAssignees(task, []int{outsider})
+	if err != ErrNoAssignees {
+		t.Fatalf("err = %v, want %v", err, ErrNoAssignees)
+	}
+	if got := assignedUsers(t, db, roomID)["task"]; !reflect.DeepEqual(got, []int{a, b}) {
+		t.Errorf("assigned = %v, want the members to keep the task", got)
+	}
+
+	err = m.SetAssignees(task, []int{b, outsider})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := assignedUsers(t, db, roomID)["task"]; !reflect.DeepEqual(got, []int{b}) {
+		t.Errorf("assigned = %v, want [%d]", got, b)
+	}
+}
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RoomTemplate is a reusable task list for new rooms. Built-in templates have
+// no owner, personal ones belong to the user that saved them.
+type RoomTemplate struct {
+	ID      int64  `json:"id"`
+	UserID  int64  `json:"user_id,omitempty"`
+	Title   string `json:"title"`
+	Tasks   []Task `json:"tasks"`
+	BuiltIn bool   `json:"built_in"`
+}
+
+type TemplateModel struct {
+	DB *sql.DB
+}
+
+func (m TemplateModel) Insert(template *RoomTemplate) error {
+	query := `
+		INSERT INTO room_templates (user_id, title, tasks)
+		VALUES ($1, $2, $3)
+		RETURNING id`
+
+	tasks, err := json.Marshal(templateTasks(template.Tasks))
+	if err != nil {
+		return err
+	}
+	args := []interface{}{template.UserID, template.Title, tasks}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&template.ID)
+}
+
+func (m TemplateModel) GetByID(id int64) (*RoomTemplate, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), title, tasks
+		FROM room_templates
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var template RoomTemplate
+	var tasks []byte
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&template.ID, &template.UserID, &template.Title, &tasks)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	template.BuiltIn = template.UserID == 0
+	err = json.Unmarshal(tasks, &template.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// GetAllForUser returns the built-in templates followed by the personal
+// templates of the given user.
+func (m TemplateModel) GetAllForUser(userID int) ([]RoomTemplate, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), title, tasks
+		FROM room_templates
+		WHERE user_id IS NULL OR user_id = $1
+		ORDER BY user_id NULLS FIRST, title`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []RoomTemplate
+	for rows.Next() {
+		var template RoomTemplate
+		var tasks []byte
+		err = rows.Scan(&template.ID, &template.UserID, &template.Title, &tasks)
+		if err != nil {
+			return nil, err
+		}
+		template.BuiltIn = template.UserID == 0
+		err = json.Unmarshal(tasks, &template.Tasks)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// Delete removes a personal template. Built-in templates and templates of
+// other users are reported as not found.
+func (m TemplateModel) Delete(id int64, userID int) error {
+	query := `
+		DELETE FROM room_templates
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// templateTasks strips the room specific fields from tasks before they are
+// stored in a template.
+func templateTasks(tasks []Task) []Task {
+	out := make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		task := Task{
+			Title:       t.Title,
+			Description: t.Description,
+			Schedule:    t.Schedule,
+			DueTime:     t.DueTime,
+			Priority:    t.Priority,
+			Kind:        t.Kind,
+			Unit:        t.Unit,
+			Target:      t.Target,
+		}
+		for _, item := range t.Items {
+			task.Items = append(task.Items, TaskItem{Title: item.Title})
+		}
+		out = append(out, task)
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginThrottle counts the recent failed logins for a key, which is an
+// account or an IP address.
+type LoginThrottle struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Locked reports whether logins for the key are blocked at the given time.
+func (t LoginThrottle) Locked(now time.Time) bool {
+	return now.Before(t.LockedUntil)
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// Attempt claims a login attempt for the key. Failures older than window
+// are forgotten first. When wait, given the throttle, asks the attempt to
+// wait, Attempt returns that duration and changes nothing. Otherwise the
+// attempt is counted as a failure right away, before the password is
+// checked, so concurrent attempts cannot all pass the check before any of
+// them is recorded. Refund takes the count back when the credentials
+// turn out to be valid.
+func (m LoginThrottleModel) Attempt(key string, window time.Duration, wait func(*LoginThrottle, time.Time) time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO login_throttles (key, failures, last_failure)
+		VALUES ($1, 0, NOW())
+		ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return 0, err
+	}
+
+	throttle := &LoginThrottle{Key: key}
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT failures, last_failure, locked_until
+		FROM login_throttles
+		WHERE key = $1
+		FOR UPDATE`, key).Scan(&throttle.Failures, &throttle.LastFailure, &lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	throttle.LockedUntil = lockedUntil.Time
+
+	now := time.Now()
+	if now.Sub(throttle.LastFailure) > window {
+		throttle.Failures = 0
+	}
+	if d := wait(throttle, now); d > 0 {
+		return d, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE login_throttles SET failures = $2, last_failure = $3
+		WHERE key = $1`, key, throttle.Failures+1, now)
+	if err != nil {
+		return 0, err
+	}
+	return 0, tx.Commit()
+}
+
+// Refund takes back the failure an attempt counted for the key.
+func (m LoginThrottleModel) Refund(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE login_throttles SET failures = GREATEST(failures - 1, 0)
+		WHERE key = $1`, key)
+	return err
+}
+
+// Lock locks the key for lockFor once it has counted lockAfter failures, and
+// starts the count over. It returns the throttle as it was before the count
+// was cleared; locked reports whether this call caused the lock.
+func (m LoginThrottleModel) Lock(key string, lockAfter int, lockFor time.Duration) (throttle *LoginThrottle, locked bool, err error) {
+	query := `
+		UPDATE login_throttles t
+		SET failures = 0, locked_until = $3
+		FROM (SELECT key, failures FROM login_throttles WHERE key = $1 FOR UPDATE) prev
+		WHERE t.key = prev.key AND prev.failures >= $2
+		RETURNING prev.failures, t.last_failure, t.locked_until`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	throttle = &LoginThrottle{Key: key}
+	err = m.DB.QueryRowContext(ctx, query, key, lockAfter, time.Now().Add(lockFor)).Scan(
+		&throttle.Failures,
+		&throttle.LastFailure,
+		&throttle.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return throttle, false, nil
+		default:
+			return nil, false, err
+		}
+	}
+	return throttle, true, nil
+}
+
+// Reset forgets the failures of the key, for example after a successful
+// login.
+func (m LoginThrottleModel) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+// DeleteStale deletes the throttles that are not locked and saw no failure
+// within window.
+func (m LoginThrottleModel) DeleteStale(window time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_throttles
+		WHERE last_failure < NOW() - make_interval(secs => $1)
+		AND (locked_until IS NULL OR locked_until < NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
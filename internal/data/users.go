@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
@@ -20,7 +20,28 @@ type User struct {
 	Email     string
 	Password  password
 	Activated bool
-	Version   int
+	Admin     bool
+	// PasswordChangedAt is when the password was last set. Sessions started
+	// before it are no longer valid.
+	PasswordChangedAt time.Time
+	// TOTPEnabled is set once the user has confirmed two-factor
+	// authentication with a first code from their authenticator app.
+	TOTPEnabled bool
+	// TimeZone is the IANA name of the zone dates are shown in.
+	TimeZone string
+	// MutedNotifications lists the notification kinds the user turned off.
+	MutedNotifications []string
+	// DeletionRequestedAt is when the user asked for their account to be
+	// deleted, or zero. The account is deleted once the grace period after
+	// it has passed.
+	DeletionRequestedAt time.Time
+	// DeactivatedAt is when a site admin deactivated the account, or zero.
+	// Deactivated accounts cannot log in.
+	DeactivatedAt time.Time
+	// PasswordResetRequired makes the user choose a new password before
+	// they can do anything else.
+	PasswordResetRequired bool
+	Version               int
 }
 type UserTasks struct {
 	UserID int
@@ -28,10 +49,19 @@ type UserTasks struct {
 	Task   *[]Task
 }
 type UserTask struct {
-	UserID int
-	User   string
-	Task   string
-	Done   bool
+	UserID     int
+	User       string
+	TaskID     int64
+	Task       string
+	Kind       string
+	Unit       string
+	Target     int
+	Progress   int
+	Done       bool
+	ItemsDone  int
+	ItemsTotal int
+	ProofID    int64
+	Review     string
 }
 
 type password struct {
@@ -51,7 +81,16 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// IsSet reports whether the user has a password. Accounts created through
+// single sign-on have none until the user chooses one.
+func (p password) IsSet() bool {
+	return len(p.hash) > 0
+}
+
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if !p.IsSet() {
+		return false, nil
+	}
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		switch {
@@ -70,10 +109,15 @@ type UserModel struct {
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-			INSERT INTO users (name, email, password_hash, activated)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO users (name, email, password_hash, activated, password_changed_at)
+			VALUES ($1, $2, $3, $4, $5)
 			RETURNING id, created_at, version`
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	user.PasswordChangedAt = time.Now()
+	hash := user.Password.hash
+	if hash == nil {
+		hash = []byte{}
+	}
+	args := []interface{}{user.Name, user.Email, hash, user.Activated, user.PasswordChangedAt}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -92,7 +136,8 @@ func (m UserModel) Insert(user *User) error {
 func (m UserModel) GetAll() ([]User, error) {
 	query := `
  		SELECT id, name, email
-		FROM users`
+		FROM users
+		WHERE deleted_at IS NULL`
 
 	var users []User
 
@@ -122,10 +167,12 @@ func (m UserModel) GetAll() ([]User, error) {
 }
 func (m UserModel) Get(id int) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, admin, totp_enabled, password_changed_at, time_zone, muted_notifications, deletion_requested_at,
+			deactivated_at, password_reset_required, version
 		FROM users
 		WHERE id = $1`
 	var user User
+	var deletionRequestedAt, deactivatedAt sql.NullTime
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -137,6 +184,14 @@ func (m UserModel) Get(id int) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Admin,
+		&user.TOTPEnabled,
+		&user.PasswordChangedAt,
+		&user.TimeZone,
+		pq.Array(&user.MutedNotifications),
+		&deletionRequestedAt,
+		&deactivatedAt,
+		&user.PasswordResetRequired,
 		&user.Version,
 	)
 	if err != nil {
@@ -147,16 +202,20 @@ func (m UserModel) Get(id int) (*User, error) {
 			return nil, err
 		}
 	}
+	user.DeletionRequestedAt = deletionRequestedAt.Time
+	user.DeactivatedAt = deactivatedAt.Time
 	return &user, nil
 }
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, admin, totp_enabled, password_changed_at, time_zone, muted_notifications, deletion_requested_at,
+			deactivated_at, password_reset_required, version
 		FROM users
 		WHERE email = $1`
 
 	var user User
+	var deletionRequestedAt, deactivatedAt sql.NullTime
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -168,6 +227,14 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Admin,
+		&user.TOTPEnabled,
+		&user.PasswordChangedAt,
+		&user.TimeZone,
+		pq.Array(&user.MutedNotifications),
+		&deletionRequestedAt,
+		&deactivatedAt,
+		&user.PasswordResetRequired,
 		&user.Version,
 	)
 	if err != nil {
@@ -178,28 +245,42 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 			return nil, err
 		}
 	}
+	user.DeletionRequestedAt = deletionRequestedAt.Time
+	user.DeactivatedAt = deactivatedAt.Time
 	return &user, nil
 }
 
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
-		RETURNING version`
-
+		SET name = $1, email = $2, password_hash = $3, activated = $4, time_zone = $5,
+			muted_notifications = $6, version = version + 1,
+			password_changed_at = CASE WHEN password_hash = $3 THEN password_changed_at ELSE $7 END,
+			password_reset_required = password_reset_required AND password_hash = $3
+		WHERE id = $8 AND version = $9
+		RETURNING version, password_changed_at, password_reset_required`
+
+	muted := user.MutedNotifications
+	if muted == nil {
+		muted = []string{}
+	}
+	// The change time comes from the application clock, which also stamps
+	// the sessions it is compared with.
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.TimeZone,
+		pq.Array(muted),
+		time.Now(),
 		user.ID,
 		user.Version,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version, &user.PasswordChangedAt, &user.PasswordResetRequired)
 
 	if err != nil {
 		switch {
@@ -241,17 +322,33 @@ func (m UserModel) GetRoomsByUser(id int) ([]Room, error) {
 	return rooms, nil
 }
 
-func (m UserModel) GetTasksByUser(id int) ([]Task, error) {
+// GetTasksByUser returns the tasks assigned to the user that match the
+// filters, together with the user's own state and tags for each task.
+func (m UserModel) GetTasksByUser(id int, filters TaskFilters) ([]Task, error) {
 	query := `
-		SELECT t.id, t.title, t.room_id, ut.done from tasks t
-		INNER JOIN users_tasks ut ON t.id = ut.task_id AND ut.user_id = $1`
+		SELECT t.id, t.title, t.room_id, r.title, t.schedule, COALESCE(to_char(t.due_time, 'HH24:MI'), ''), t.priority, t.position,
+			t.kind, t.unit, t.target, t.requires_proof, ut.progress, ut.done, ut.review,
+			COALESCE((SELECT array_agg(tg.name ORDER BY tg.name) FROM tasks_tags tt
+				INNER JOIN tags tg ON tg.id = tt.tag_id
+				WHERE tt.task_id = t.id AND tg.user_id = $1), '{}')
+		FROM tasks t
+		INNER JOIN users_tasks ut ON t.id = ut.task_id AND ut.user_id = $1
+		INNER JOIN rooms r ON r.id = t.room_id
+		WHERE ($2 = 0 OR t.room_id = $2)
+		AND ($3 = '' OR EXISTS (SELECT 1 FROM tasks_tags tt
+			INNER JOIN tags tg ON tg.id = tt.tag_id
+			WHERE tt.task_id = t.id AND tg.user_id = $1 AND tg.name = $3))
+		AND ($4 = '' OR ($4 = 'done') = ut.done)
+		AND ($5 = '' OR t.due_time <= NULLIF($5, '')::time)
+		ORDER BY r.title, t.room_id, t.position, t.id`
+
+	args := []interface{}{id, filters.RoomID, filters.Tag, filters.Done, filters.DueBefore}
 
 	var tasks []Task
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	fmt.Println("no dta")
-	rows, err := m.DB.QueryContext(ctx, query, id)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -260,9 +357,27 @@ func (m UserModel) GetTasksByUser(id int) ([]Task, error) {
 			return nil, err
 		}
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var task Task
-		err = rows.Scan(&task.ID, &task.Title, &task.RoomID, &task.Done)
+		err = rows.Scan(
+			&task.ID,
+			&task.Title,
+			&task.RoomID,
+			&task.RoomTitle,
+			&task.Schedule,
+			&task.DueTime,
+			&task.Priority,
+			&task.Position,
+			&task.Kind,
+			&task.Unit,
+			&task.Target,
+			&task.RequiresProof,
+			&task.Progress,
+			&task.Done,
+			&task.Review,
+			pq.Array(&task.Tags),
+		)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
@@ -274,7 +389,7 @@ func (m UserModel) GetTasksByUser(id int) ([]Task, error) {
 		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
 func (m UserModel) InsertRoomUser(userID, roomID int) error {
@@ -299,6 +414,42 @@ func (m UserModel) InsertRoomUser(userID, roomID int) error {
 	return nil
 }
 
+// SetRoomAdmin grants or revokes the admin rights of a room member.
+func (m UserModel) SetRoomAdmin(userID, roomID int, admin bool) error {
+	query := `
+		UPDATE rooms_users SET admin = $3
+		WHERE user_id = $1 AND room_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, roomID, admin)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// IsRoomAdmin reports whether the user is an admin of the room.
+func (m UserModel) IsRoomAdmin(userID int, roomID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM rooms_users WHERE user_id = $1 AND room_id = $2 AND admin)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var admin bool
+	err := m.DB.QueryRowContext(ctx, query, userID, roomID).Scan(&admin)
+	return admin, err
+}
+
 func (m UserModel) RemoveRoomUser(userID, roomID int) error {
 	query := `DELETE FROM users_tasks 
 				WHERE user_id = $1 AND task_id IN (SELECT id FROM tasks WHERE room_id = $2)`
@@ -312,6 +463,18 @@ func (m UserModel) RemoveRoomUser(userID, roomID int) error {
 	if err != nil {
 		return err
 	}
+	query = `UPDATE task_duties SET ended_at = NOW()
+				WHERE user_id = $1 AND ended_at IS NULL AND task_id IN (SELECT id FROM tasks WHERE room_id = $2)`
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	query = `DELETE FROM task_assignees 
+				WHERE user_id = $1 AND task_id IN (SELECT id FROM tasks WHERE room_id = $2)`
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
 	query = `DELETE FROM rooms_users 
 				WHERE user_id = $1 AND room_id = $2`
 	_, err = m.DB.ExecContext(ctx, query, args...)
@@ -363,6 +526,34 @@ func (m UserModel) GetUsersByRoom(roomID int) ([]int, error) {
 	return users, nil
 }
 
+// GetMembersByRoom returns the members of a room ordered by name.
+func (m UserModel) GetMembersByRoom(roomID int64) ([]User, error) {
+	query := `
+		SELECT u.id, u.name, u.email FROM users u
+		INNER JOIN rooms_users ru ON ru.user_id = u.id AND ru.room_id = $1
+		ORDER BY u.name, u.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Name, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 func (m UserModel) InsertUserTask(userID, taskID int) error {
 	query := `
 		INSERT INTO users_tasks (user_id, task_id, done)
@@ -382,10 +573,17 @@ func (m UserModel) InsertUserTask(userID, taskID int) error {
 
 func (m UserModel) GetUserTask(roomID int64) ([]UserTask, error) {
 	query := `
-		SELECT u.id, u.name, t.title, ut.done FROM users_tasks ut 
+		SELECT u.id, u.name, t.id, t.title, t.kind, t.unit, t.target, ut.progress, ut.done,
+		    (SELECT COUNT(*) FROM users_task_items uti
+		        JOIN task_items ti ON ti.id = uti.item_id
+		        WHERE ti.task_id = t.id AND uti.user_id = u.id AND uti.done),
+		    (SELECT COUNT(*) FROM task_items ti WHERE ti.task_id = t.id),
+		    COALESCE(ut.proof_id, 0), ut.review
+		FROM users_tasks ut 
 		    JOIN users u ON u.id = ut.user_id 
 		    JOIN tasks t ON t.id = ut.task_id
-		    AND t.room_id = $1`
+		    AND t.room_id = $1
+		ORDER BY t.position, t.id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -396,7 +594,21 @@ func (m UserModel) GetUserTask(roomID int64) ([]UserTask, error) {
 	}
 	for rows.Next() {
 		var userTask UserTask
-		err = rows.Scan(&userTask.UserID, &userTask.User, &userTask.Task, &userTask.Done)
+		err = rows.Scan(
+			&userTask.UserID,
+			&userTask.User,
+			&userTask.TaskID,
+			&userTask.Task,
+			&userTask.Kind,
+			&userTask.Unit,
+			&userTask.Target,
+			&userTask.Progress,
+			&userTask.Done,
+			&userTask.ItemsDone,
+			&userTask.ItemsTotal,
+			&userTask.ProofID,
+			&userTask.Review,
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -408,15 +620,20 @@ func (m UserModel) GetUserTask(roomID int64) ([]UserTask, error) {
 
 func (m UserModel) GetUserTaskByBothID(userID int, taskID int64) (*UserTask, error) {
 	query := `
-		SELECT user_id, task_id, done FROM users_tasks 
+		SELECT user_id, task_id, done, review FROM users_tasks 
 		WHERE user_id = $1 and task_id = $2`
 	args := []interface{}{userID, taskID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	var userTask UserTask
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&userTask.User, &userTask.Task, &userTask.Done)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&userTask.User, &userTask.Task, &userTask.Done, &userTask.Review)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 	return &userTask, err
 }
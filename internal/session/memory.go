@@ -0,0 +1,111 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a Store that keeps sessions in process memory. Sessions are lost
+// on restart, so it is meant for tests and local development.
+type Memory struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemory() *Memory {
+	return &Memory{records: make(map[string]Record)}
+}
+
+func (m *Memory) Find(ctx context.Context, id string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[id]
+	if !ok || time.Now().After(record.Expiry) {
+		return nil, ErrNotFound
+	}
+	record.Data = append([]byte(nil), record.Data...)
+	return &record, nil
+}
+
+func (m *Memory) Insert(ctx context.Context, record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.save(record)
+	return nil
+}
+
+func (m *Memory) Update(ctx context.Context, record *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.records[record.ID]
+	if !ok || time.Now().After(stored.Expiry) {
+		return ErrNotFound
+	}
+	m.save(record)
+	return nil
+}
+
+// save stores a copy of record. The caller holds m.mu.
+func (m *Memory) save(record *Record) {
+	saved := *record
+	saved.Data = append([]byte(nil), record.Data...)
+	m.records[record.ID] = saved
+}
+
+func (m *Memory) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, id)
+	return nil
+}
+
+func (m *Memory) FindByUser(ctx context.Context, userID int) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var records []Record
+	for _, record := range m.records {
+		if record.UserID == userID && now.Before(record.Expiry) {
+			record.Data = nil
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+	return records, nil
+}
+
+func (m *Memory) DeleteByUser(ctx context.Context, userID int, except string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, record := range m.records {
+		if record.UserID == userID && id != except {
+			delete(m.records, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteExpired(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for id, record := range m.records {
+		if now.After(record.Expiry) {
+			delete(m.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
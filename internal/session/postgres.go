@@ -0,0 +1,167 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Postgres is a Store that keeps sessions in the sessions table.
+type Postgres struct {
+	DB *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{DB: db}
+}
+
+func (p *Postgres) Find(ctx context.Context, id string) (*Record, error) {
+	query := `
+		SELECT id, COALESCE(user_id, 0), data, user_agent, ip, created_at, last_seen, expiry
+		FROM sessions
+		WHERE id = $1 AND expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var record Record
+	err := p.DB.QueryRowContext(ctx, query, id).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Data,
+		&record.UserAgent,
+		&record.IP,
+		&record.CreatedAt,
+		&record.LastSeen,
+		&record.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+func (p *Postgres) Insert(ctx context.Context, record *Record) error {
+	query := `
+		INSERT INTO sessions (id, user_id, data, user_agent, ip, created_at, last_seen, expiry)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8)`
+
+	args := []interface{}{
+		record.ID,
+		record.UserID,
+		record.Data,
+		record.UserAgent,
+		record.IP,
+		record.CreatedAt,
+		record.LastSeen,
+		record.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (p *Postgres) Update(ctx context.Context, record *Record) error {
+	query := `
+		UPDATE sessions
+		SET user_id = NULLIF($2, 0), data = $3, user_agent = $4, ip = $5, last_seen = $6, expiry = $7
+		WHERE id = $1 AND expiry > NOW()`
+
+	args := []interface{}{
+		record.ID,
+		record.UserID,
+		record.Data,
+		record.UserAgent,
+		record.IP,
+		record.LastSeen,
+		record.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+func (p *Postgres) FindByUser(ctx context.Context, userID int) ([]Record, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen, expiry
+		FROM sessions
+		WHERE user_id = $1 AND expiry > NOW()
+		ORDER BY last_seen DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var record Record
+		err = rows.Scan(
+			&record.ID,
+			&record.UserID,
+			&record.UserAgent,
+			&record.IP,
+			&record.CreatedAt,
+			&record.LastSeen,
+			&record.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (p *Postgres) DeleteByUser(ctx context.Context, userID int, except string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, except)
+	return err
+}
+
+func (p *Postgres) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expiry <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
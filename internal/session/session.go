@@ -0,0 +1,408 @@
+// Package session keeps HTTP sessions on the server. The cookie only holds a
+// random token, so unlike a signed cookie a session can be listed and
+// revoked before it expires.
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	cookieName = "session"
+	// touchInterval limits how often the last seen time of a session is
+	// written when nothing else in it changed.
+	touchInterval = time.Minute
+)
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+type contextKey string
+
+var contextKeyState = contextKey("session")
+
+// Session loads and saves the session of each request through Store. Its
+// methods mirror the signed cookie sessions used before, so handlers only
+// deal with keys and values.
+type Session struct {
+	Store Store
+	key   []byte
+	// Lifetime is how long a session lives after it was last used.
+	Lifetime time.Duration
+	// UserKey is the key holding the ID of the logged in user. It is saved
+	// with the record so the sessions of a user can be listed.
+	UserKey  string
+	Path     string
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	ErrorLog func(error)
+}
+
+// New returns a Session saving to store. The key is used to derive record
+// IDs from tokens, so changing it invalidates all sessions.
+func New(store Store, key []byte) *Session {
+	return &Session{
+		Store:    store,
+		key:      key,
+		Lifetime: 24 * time.Hour,
+		UserKey:  "userID",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		ErrorLog: func(error) {},
+	}
+}
+
+type state struct {
+	mu        sync.Mutex
+	token     string
+	record    Record
+	values    map[string]interface{}
+	stored    bool
+	staleID   string
+	modified  bool
+	destroyed bool
+}
+
+func (s *Session) hashToken(token string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newState() *state {
+	now := time.Now()
+	return &state{
+		record: Record{CreatedAt: now, LastSeen: now},
+		values: make(map[string]interface{}),
+	}
+}
+
+func (s *Session) load(r *http.Request) (*state, error) {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return newState(), nil
+	}
+	record, err := s.Store.Find(r.Context(), s.hashToken(cookie.Value))
+	if err == ErrNotFound {
+		return newState(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if len(record.Data) > 0 {
+		err = gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	record.Data = nil
+	return &state{token: cookie.Value, record: *record, values: values, stored: true}, nil
+}
+
+func (s *Session) save(w http.ResponseWriter, r *http.Request, st *state) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.staleID != "" {
+		err := s.Store.Delete(r.Context(), st.staleID)
+		if err != nil {
+			return err
+		}
+	}
+	if st.destroyed {
+		s.expireCookie(w)
+		return nil
+	}
+
+	now := time.Now()
+	touch := st.stored && now.Sub(st.record.LastSeen) > touchInterval
+	if !st.modified && !touch {
+		return nil
+	}
+	if !st.stored && len(st.values) == 0 {
+		return nil
+	}
+	if !st.stored {
+		token, err := generateToken()
+		if err != nil {
+			return err
+		}
+		st.token = token
+		st.record.ID = s.hashToken(token)
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(st.values)
+	if err != nil {
+		return err
+	}
+	record := st.record
+	record.UserID, _ = st.values[s.UserKey].(int)
+	record.Data = buf.Bytes()
+	record.UserAgent = r.UserAgent()
+	record.IP = clientIP(r)
+	record.LastSeen = now
+	record.Expiry = now.Add(s.Lifetime)
+	if st.stored {
+		err = s.Store.Update(r.Context(), &record)
+	} else {
+		err = s.Store.Insert(r.Context(), &record)
+	}
+	if err == ErrNotFound {
+		// The session was revoked while the request ran.
+		s.expireCookie(w)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	w.Header().Add("Vary", "Cookie")
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    st.token,
+		Path:     s.Path,
+		Secure:   s.Secure,
+		HttpOnly: s.HttpOnly,
+		SameSite: s.SameSite,
+		Expires:  time.Unix(record.Expiry.Unix()+1, 0),
+		MaxAge:   int(s.Lifetime.Seconds()),
+	})
+	return nil
+}
+
+func (s *Session) expireCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     s.Path,
+		Secure:   s.Secure,
+		HttpOnly: s.HttpOnly,
+		SameSite: s.SameSite,
+		Expires:  time.Unix(1, 0),
+		MaxAge:   -1,
+	})
+}
+
+// Enable loads the session for each request and saves it once the handler
+// has returned. The response is buffered so the cookie can still be set.
+func (s *Session) Enable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, err := s.load(r)
+		if err != nil {
+			s.ErrorLog(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyState, st))
+
+		bw := &bufferedResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, r)
+
+		err = s.save(w, r, st)
+		if err != nil {
+			s.ErrorLog(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if bw.code != 0 {
+			w.WriteHeader(bw.code)
+		}
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+func (s *Session) state(r *http.Request) *state {
+	st, ok := r.Context().Value(contextKeyState).(*state)
+	if !ok {
+		panic("session: Enable middleware is not in the chain")
+	}
+	return st
+}
+
+func (s *Session) Put(r *http.Request, key string, val interface{}) {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.values[key] = val
+	st.modified = true
+	st.destroyed = false
+}
+
+func (s *Session) Get(r *http.Request, key string) interface{} {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.values[key]
+}
+
+func (s *Session) Pop(r *http.Request, key string) interface{} {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	val, ok := st.values[key]
+	if !ok {
+		return nil
+	}
+	delete(st.values, key)
+	st.modified = true
+	return val
+}
+
+func (s *Session) Remove(r *http.Request, key string) {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.values[key]; !ok {
+		return
+	}
+	delete(st.values, key)
+	st.modified = true
+}
+
+func (s *Session) Exists(r *http.Request, key string) bool {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	_, ok := st.values[key]
+	return ok
+}
+
+func (s *Session) GetString(r *http.Request, key string) string {
+	val, _ := s.Get(r, key).(string)
+	return val
+}
+
+func (s *Session) GetBool(r *http.Request, key string) bool {
+	val, _ := s.Get(r, key).(bool)
+	return val
+}
+
+func (s *Session) GetInt(r *http.Request, key string) int {
+	val, _ := s.Get(r, key).(int)
+	return val
+}
+
+func (s *Session) GetTime(r *http.Request, key string) time.Time {
+	val, _ := s.Get(r, key).(time.Time)
+	return val
+}
+
+func (s *Session) PopString(r *http.Request, key string) string {
+	val, _ := s.Pop(r, key).(string)
+	return val
+}
+
+// RenewToken gives the session a new token and creation time while keeping
+// its values. It should be called whenever the user logs in, so a token
+// planted before cannot be used to ride on the login.
+func (s *Session) RenewToken(r *http.Request) {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.stored {
+		st.staleID = st.record.ID
+	}
+	st.token = ""
+	st.stored = false
+	st.record.CreatedAt = time.Now()
+	st.modified = true
+}
+
+// Destroy deletes the session, for example on logout. Values put after it
+// go into a new session.
+func (s *Session) Destroy(r *http.Request) {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.stored {
+		st.staleID = st.record.ID
+	}
+	fresh := newState()
+	st.token, st.record, st.values, st.stored = "", fresh.record, fresh.values, false
+	st.modified = true
+	st.destroyed = true
+}
+
+// ID returns the ID of the current session, which is empty until the session
+// was saved.
+func (s *Session) ID(r *http.Request) string {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.record.ID
+}
+
+// CreatedAt returns when the current session was created or last renewed.
+func (s *Session) CreatedAt(r *http.Request) time.Time {
+	st := s.state(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.record.CreatedAt
+}
+
+// Revoke deletes a session of the user. It returns ErrNotFound if the user
+// has no live session with that ID.
+func (s *Session) Revoke(ctx context.Context, userID int, id string) error {
+	record, err := s.Store.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if record.UserID != userID {
+		return ErrNotFound
+	}
+	return s.Store.Delete(ctx, id)
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf  bytes.Buffer
+	code int
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	bw.code = code
+}
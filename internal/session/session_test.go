@@ -0,0 +1,250 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// do runs handler behind s.Enable with the given cookie and returns the
+// session cookie of the response, if any.
+func do(t *testing.T, s *Session, cookie *http.Cookie, handler func(r *http.Request)) *http.Cookie {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(r)
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == cookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 7)
+		s.Put(r, "flash", "hello")
+		s.Put(r, "at", at)
+	})
+	if cookie == nil || cookie.Value == "" {
+		t.Fatal("no session cookie was set")
+	}
+
+	do(t, s, cookie, func(r *http.Request) {
+		if got := s.GetInt(r, "userID"); got != 7 {
+			t.Errorf("userID = %d, want 7", got)
+		}
+		if got := s.PopString(r, "flash"); got != "hello" {
+			t.Errorf("flash = %q, want hello", got)
+		}
+		if got := s.GetTime(r, "at"); !got.Equal(at) {
+			t.Errorf("at = %v, want %v", got, at)
+		}
+	})
+	do(t, s, cookie, func(r *http.Request) {
+		if s.Exists(r, "flash") {
+			t.Error("popped value is still in the session")
+		}
+	})
+
+	records, err := store.FindByUser(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("FindByUser returned %d sessions, want 1", len(records))
+	}
+}
+
+func TestTokenIsHashed(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 1)
+	})
+
+	if _, err := store.Find(context.Background(), cookie.Value); err != ErrNotFound {
+		t.Errorf("the raw token finds a record: %v", err)
+	}
+	record, err := store.Find(context.Background(), s.hashToken(cookie.Value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.ID == cookie.Value {
+		t.Error("the record ID is the token")
+	}
+
+	other := New(store, []byte("another key, another set of IDs!"))
+	do(t, other, cookie, func(r *http.Request) {
+		if other.Exists(r, "userID") {
+			t.Error("the session was found with a different key")
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 1)
+	})
+
+	id := s.hashToken(cookie.Value)
+	record, err := store.Find(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Expiry = time.Now().Add(-time.Second)
+	store.Insert(context.Background(), record)
+
+	do(t, s, cookie, func(r *http.Request) {
+		if s.Exists(r, "userID") {
+			t.Error("an expired session was loaded")
+		}
+	})
+	n, err := store.DeleteExpired(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteExpired deleted %d sessions, want 1", n)
+	}
+}
+
+func TestRenewToken(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	old := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "flash", "kept")
+	})
+	renewed := do(t, s, old, func(r *http.Request) {
+		s.RenewToken(r)
+		s.Put(r, "userID", 3)
+	})
+	if renewed == nil || renewed.Value == old.Value {
+		t.Fatal("the token was not renewed")
+	}
+	if _, err := store.Find(context.Background(), s.hashToken(old.Value)); err != ErrNotFound {
+		t.Errorf("the old session still exists: %v", err)
+	}
+	do(t, s, renewed, func(r *http.Request) {
+		if s.GetString(r, "flash") != "kept" || s.GetInt(r, "userID") != 3 {
+			t.Error("values were lost on renewal")
+		}
+	})
+}
+
+func TestDestroy(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 1)
+	})
+	cleared := do(t, s, cookie, func(r *http.Request) {
+		s.Destroy(r)
+	})
+	if cleared == nil || cleared.MaxAge >= 0 {
+		t.Error("the cookie was not cleared")
+	}
+	if _, err := store.Find(context.Background(), s.hashToken(cookie.Value)); err != ErrNotFound {
+		t.Errorf("the session still exists: %v", err)
+	}
+}
+
+// TestRevokeDuringRequest checks that a request which is still running when
+// its session is revoked does not write the session back.
+func TestRevokeDuringRequest(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 5)
+	})
+	id := s.hashToken(cookie.Value)
+
+	cleared := do(t, s, cookie, func(r *http.Request) {
+		err := s.Revoke(context.Background(), 5, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Put(r, "flash", "too late")
+	})
+	if _, err := store.Find(context.Background(), id); err != ErrNotFound {
+		t.Errorf("the revoked session was saved again: %v", err)
+	}
+	if cleared == nil || cleared.MaxAge >= 0 {
+		t.Error("the cookie of the revoked session was not cleared")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Put(r, "userID", 5)
+	})
+	id := s.hashToken(cookie.Value)
+
+	if err := s.Revoke(context.Background(), 6, id); err != ErrNotFound {
+		t.Errorf("another user revoked the session: %v", err)
+	}
+	if err := s.Revoke(context.Background(), 5, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(context.Background(), 5, id); err != ErrNotFound {
+		t.Errorf("revoking twice returned %v", err)
+	}
+}
+
+func TestDeleteByUser(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		cookie := do(t, s, nil, func(r *http.Request) {
+			s.Put(r, "userID", 9)
+		})
+		ids = append(ids, s.hashToken(cookie.Value))
+	}
+	err := store.DeleteByUser(context.Background(), 9, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := store.FindByUser(context.Background(), 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != ids[0] {
+		t.Errorf("FindByUser = %v, want only the kept session", records)
+	}
+}
+
+func TestEmptySessionIsNotStored(t *testing.T) {
+	store := NewMemory()
+	s := New(store, testKey)
+	cookie := do(t, s, nil, func(r *http.Request) {
+		s.Get(r, "userID")
+	})
+	if cookie != nil {
+		t.Error("a cookie was set for an empty session")
+	}
+	if len(store.records) != 0 {
+		t.Errorf("%d sessions were stored", len(store.records))
+	}
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Record is a session as kept by a Store. The ID is a hash of the token in
+// the cookie, so whoever can read the store still cannot take over sessions.
+type Record struct {
+	ID        string
+	UserID    int
+	Data      []byte
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	Expiry    time.Time
+}
+
+// Store keeps session records on the server, so sessions can be listed and
+// revoked. Find must not return records past their expiry.
+type Store interface {
+	Find(ctx context.Context, id string) (*Record, error)
+	// Insert stores a new session.
+	Insert(ctx context.Context, record *Record) error
+	// Update saves a session that already exists. It returns ErrNotFound
+	// when the session was deleted meanwhile, so a request still running
+	// when its session is revoked cannot bring it back.
+	Update(ctx context.Context, record *Record) error
+	Delete(ctx context.Context, id string) error
+	// FindByUser returns the live sessions of a user, most recently used
+	// first.
+	FindByUser(ctx context.Context, userID int) ([]Record, error)
+	// DeleteByUser deletes all sessions of a user except the one with the
+	// given ID, which may be empty.
+	DeleteByUser(ctx context.Context, userID int, except string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
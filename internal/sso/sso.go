@@ -0,0 +1,201 @@
+// Package sso logs users in through OpenID Connect providers. Each provider
+// is set up from its issuer URL by discovery, uses the authorization code
+// flow with PKCE and verifies ID tokens against the keys the issuer
+// publishes.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"net/http"
+	"os"
+)
+
+var (
+	ErrMissingIDToken = errors.New("sso: token response has no id_token")
+	ErrNonceMismatch  = errors.New("sso: ID token nonce does not match")
+	ErrStateMismatch  = errors.New("sso: callback state does not match")
+)
+
+// Config describes a provider as it is written in the providers file.
+type Config struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"`
+	// TrustEmail accepts the email addresses of the provider without an
+	// email_verified claim. Only set it for providers that never hand out
+	// addresses their users have not proven to own.
+	TrustEmail bool `json:"trust_email,omitempty"`
+}
+
+// ReadConfig reads the providers file, a JSON array of Config.
+func ReadConfig(path string) ([]Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []Config
+	err = json.Unmarshal(content, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("sso: %s: %w", path, err)
+	}
+	for _, cfg := range configs {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("sso: %s: providers need a name, issuer and client_id", path)
+		}
+	}
+	return configs, nil
+}
+
+// Identity is what the provider vouches for about the user.
+type Identity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+type Provider struct {
+	Name        string
+	DisplayName string
+	trustEmail  bool
+	client      *http.Client
+	oauth2      oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+}
+
+// NewProvider discovers the issuer of cfg. Requests to the issuer, including
+// the later token exchanges and key fetches, go through client, so tests can
+// point a provider at a fake issuer. A nil client means http.DefaultClient.
+func NewProvider(cfg Config, redirectURL string, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	// The context is kept by the key set to fetch keys later, so it must
+	// not be cancelled.
+	ctx := oidc.ClientContext(context.Background(), client)
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	displayName := cfg.DisplayName
+	if displayName == "" {
+		displayName = cfg.Name
+	}
+	return &Provider{
+		Name:        cfg.Name,
+		DisplayName: displayName,
+		trustEmail:  cfg.TrustEmail,
+		client:      client,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// Flow holds the per login secrets that have to survive the redirect to the
+// provider, usually in the session.
+type Flow struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CheckState compares the state the provider sent back with the one of the
+// flow, which must not be empty.
+func (f *Flow) CheckState(state string) error {
+	if f.State == "" || subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return ErrStateMismatch
+	}
+	return nil
+}
+
+// NewFlow generates the state, nonce and PKCE verifier of a login.
+func NewFlow() (*Flow, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	return &Flow{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page for the flow.
+func (p *Provider) AuthCodeURL(flow *Flow) string {
+	return p.oauth2.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+}
+
+// Exchange trades the authorization code from the callback for tokens and
+// returns the identity of the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, flow *Flow, code string) (*Identity, error) {
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrMissingIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, ErrNonceMismatch
+	}
+	// Some providers send email_verified as a string.
+	var claims struct {
+		Identity
+		EmailVerified interface{} `json:"email_verified"`
+	}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, err
+	}
+	identity := claims.Identity
+	identity.EmailVerified = claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &identity, nil
+}
+
+// VerifiedEmail returns the email address of the identity if it may be used
+// to find or create an account: the provider verified it, or it is
+// configured with TrustEmail. Linking on an unverified address would let
+// anyone take over the account that has it.
+func (p *Provider) VerifiedEmail(identity *Identity) (string, bool) {
+	if identity.Email == "" || !(identity.EmailVerified || p.trustEmail) {
+		return "", false
+	}
+	return identity.Email, true
+}
@@ -0,0 +1,335 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "birgedo"
+
+// grant is what the fake issuer remembers about an authorization code.
+type grant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+// issuer is a fake OpenID Connect provider serving discovery, its signing
+// keys and a token endpoint that checks the PKCE verifier.
+type issuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signer signs the ID tokens; it differs from key to fake a forgery.
+	signer *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{t: t, key: key, signer: key, grants: make(map[string]grant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/keys", iss.keys)
+	mux.HandleFunc("/token", iss.token)
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (iss *issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	base := iss.server.URL
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/authorize",
+		"token_endpoint":                        base + "/token",
+		"jwks_uri":                              base + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (iss *issuer) keys(w http.ResponseWriter, r *http.Request) {
+	pub := iss.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (iss *issuer) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	iss.mu.Lock()
+	g, ok := iss.grants[r.PostForm.Get("code")]
+	delete(iss.grants, r.PostForm.Get("code"))
+	iss.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	response := map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if g.claims != nil {
+		response["id_token"] = iss.sign(g.claims)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (iss *issuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the user logging in at the provider: it reads the
+// challenge and nonce from the login URL and returns a code for them. Extra
+// claims override the defaults; a nil value removes a claim.
+func (iss *issuer) authorize(authURL string, extra map[string]interface{}) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		iss.t.Fatalf("code_challenge_method = %q", q.Get("code_challenge_method"))
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            iss.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          q.Get("nonce"),
+		"email":          "a@example.com",
+		"email_verified": true,
+		"name":           "Aigerim",
+	}
+	for k, v := range extra {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	code := "code-" + q.Get("state")
+	iss.mu.Lock()
+	iss.grants[code] = grant{challenge: q.Get("code_challenge"), claims: claims}
+	iss.mu.Unlock()
+	return code
+}
+
+func (iss *issuer) provider(cfg Config) *Provider {
+	cfg.Name = "test"
+	cfg.Issuer = iss.server.URL
+	cfg.ClientID = testClientID
+	provider, err := NewProvider(cfg, "http://localhost:4000/user/login/sso/test/callback", iss.server.Client())
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return provider
+}
+
+func newFlow(t *testing.T) *Flow {
+	flow, err := NewFlow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flow
+}
+
+func TestExchange(t *testing.T) {
+	iss := newIssuer(t)
+	provider := iss.provider(Config{})
+	flow := newFlow(t)
+	code := iss.authorize(provider.AuthCodeURL(flow), nil)
+
+	identity, err := provider.Exchange(context.Background(), flow, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Subject: "user-1", Email: "a@example.com", EmailVerified: true, Name: "Aigerim"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   map[string]interface{}
+		flow    func(*Flow) // changes the flow after the login URL was made
+		forge   bool
+		wantErr error
+	}{
+		{name: "nonce mismatch", extra: map[string]interface{}{"nonce": "other"}, wantErr: ErrNonceMismatch},
+		{name: "pkce mismatch", flow: func(f *Flow) { f.Verifier = "not-the-verifier-of-the-challenge-0123456789" }},
+		{name: "wrong audience", extra: map[string]interface{}{"aud": "someone-else"}},
+		{name: "expired", extra: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "forged signature", forge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newIssuer(t)
+			if tt.forge {
+				other, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatal(err)
+				}
+				iss.signer = other
+			}
+			provider := iss.provider(Config{})
+			flow := newFlow(t)
+			code := iss.authorize(provider.AuthCodeURL(flow), tt.extra)
+			if tt.flow != nil {
+				tt.flow(flow)
+			}
+			_, err := provider.Exchange(context.Background(), flow, code)
+			if err == nil {
+				t.Fatal("Exchange succeeded")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeWithoutIDToken(t *testing.T) {
+	iss := newIssuer(t)
+	provider := iss.provider(Config{})
+	flow := newFlow(t)
+	code := iss.authorize(provider.AuthCodeURL(flow), nil)
+	iss.mu.Lock()
+	g := iss.grants[code]
+	g.claims = nil
+	iss.grants[code] = g
+	iss.mu.Unlock()
+
+	_, err := provider.Exchange(context.Background(), flow, code)
+	if !errors.Is(err, ErrMissingIDToken) {
+		t.Errorf("err = %v, want %v", err, ErrMissingIDToken)
+	}
+}
+
+func TestCheckState(t *testing.T) {
+	flow := newFlow(t)
+	if err := flow.CheckState(flow.State); err != nil {
+		t.Errorf("the flow's own state was rejected: %v", err)
+	}
+	for _, state := range []string{"", "other", strings.ToUpper(flow.State)} {
+		if err := flow.CheckState(state); !errors.Is(err, ErrStateMismatch) {
+			t.Errorf("CheckState(%q) = %v, want %v", state, err, ErrStateMismatch)
+		}
+	}
+	empty := &Flow{}
+	if err := empty.CheckState(""); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("a flow without state accepted an empty state: %v", err)
+	}
+}
+
+// TestVerifiedEmail checks which identities may be linked to an account by
+// their email address.
+func TestVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		trust  bool
+		extra  map[string]interface{}
+		linked bool
+	}{
+		{name: "verified", linked: true},
+		{name: "verified as string", extra: map[string]interface{}{"email_verified": "true"}, linked: true},
+		{name: "unverified", extra: map[string]interface{}{"email_verified": false}},
+		{name: "unverified as string", extra: map[string]interface{}{"email_verified": "false"}},
+		{name: "claim missing", extra: map[string]interface{}{"email_verified": nil}},
+		{name: "claim missing, trusted provider", trust: true, extra: map[string]interface{}{"email_verified": nil}, linked: true},
+		{name: "unverified, trusted provider", trust: true, extra: map[string]interface{}{"email_verified": false}, linked: true},
+		{name: "no email", trust: true, extra: map[string]interface{}{"email": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newIssuer(t)
+			provider := iss.provider(Config{TrustEmail: tt.trust})
+			flow := newFlow(t)
+			code := iss.authorize(provider.AuthCodeURL(flow), tt.extra)
+			identity, err := provider.Exchange(context.Background(), flow, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			email, ok := provider.VerifiedEmail(identity)
+			if ok != tt.linked {
+				t.Fatalf("VerifiedEmail = %q, %t; want %t", email, ok, tt.linked)
+			}
+			if ok && email != "a@example.com" {
+				t.Errorf("email = %q", email)
+			}
+		})
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	path := t.TempDir() + "/providers.json"
+	write := func(content string) {
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "id", "trust_email": true}]`)
+	configs, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Name != "google" || !configs[0].TrustEmail {
+		t.Errorf("configs = %+v", configs)
+	}
+
+	write(`[{"name": "google", "issuer": "https://accounts.google.com"}]`)
+	if _, err := ReadConfig(path); err == nil {
+		t.Error("a provider without client_id was accepted")
+	}
+}
@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 4226 and RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC4226(t *testing.T) {
+	// Appendix D of RFC 4226, the HOTP values for counters 0 to 9.
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for step, code := range want {
+		got, err := Code(rfcSecret, int64(step))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != code {
+			t.Errorf("Code(step %d) = %s, want %s", step, got, code)
+		}
+	}
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B of RFC 6238 for SHA1, cut to the six digits used here.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+		step int64
+	}{
+		{"current", code(step), true, step},
+		{"spaced", code(step)[:3] + " " + code(step)[3:], true, step},
+		{"previous", code(step - 1), true, step - 1},
+		{"next", code(step + 1), true, step + 1},
+		{"too old", code(step - 2), false, 0},
+		{"too new", code(step + 2), false, 0},
+		{"short", "12345", false, 0},
+		{"empty", "", false, 0},
+	}
+	for _, tt := range tests {
+		got, ok := Validate(rfcSecret, tt.code, now)
+		if ok != tt.ok || got != tt.step {
+			t.Errorf("%s: Validate = %d, %t; want %d, %t", tt.name, got, ok, tt.step, tt.ok)
+		}
+	}
+	if _, ok := Validate(strings.ToLower(rfcSecret), code(step), now); !ok {
+		t.Error("a lower case secret was not accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret has %d bytes, want 20", len(key))
+	}
+}
+
+func TestURL(t *testing.T) {
+	u, err := url.Parse(URL("BirgeDo", "a@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/BirgeDo:a@example.com" {
+		t.Errorf("URL = %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "BirgeDo" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS due_time;
+ALTER TABLE tasks DROP COLUMN IF EXISTS schedule;
\ No newline at end of file
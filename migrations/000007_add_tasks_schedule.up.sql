@@ -0,0 +1,2 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS schedule text NOT NULL DEFAULT 'daily';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS due_time time;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS room_templates (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    title text NOT NULL,
+    tasks jsonb NOT NULL DEFAULT '[]'
+);
+
+INSERT INTO room_templates (title, tasks) VALUES
+    ('Morning routine', '[{"title": "Wake up before 7", "schedule": "daily", "due_time": "07:00"}, {"title": "Drink a glass of water", "schedule": "daily"}, {"title": "Exercise 15 minutes", "schedule": "daily", "due_time": "08:00"}, {"title": "Make the bed", "schedule": "daily"}]'),
+    ('Study sprint', '[{"title": "Two focused pomodoros", "schedule": "daily"}, {"title": "Review notes", "schedule": "daily", "due_time": "21:00"}, {"title": "Solve practice problems", "schedule": "daily"}, {"title": "Weekly recap", "schedule": "weekly"}]');
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS users_task_items;
+DROP TABLE IF EXISTS task_items;
\ No newline at end of file
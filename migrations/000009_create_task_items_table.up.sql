@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS task_items (
+    id bigserial PRIMARY KEY,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    title text NOT NULL,
+    position integer NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS users_task_items (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    item_id bigint NOT NULL REFERENCES task_items ON DELETE CASCADE,
+    done boolean NOT NULL,
+    PRIMARY KEY (user_id, item_id)
+);
@@ -0,0 +1,8 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority smallint NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS position integer NOT NULL DEFAULT 0;
+
+UPDATE tasks SET position = ordered.position
+FROM (SELECT id, row_number() OVER (PARTITION BY room_id ORDER BY id) AS position FROM tasks) AS ordered
+WHERE tasks.id = ordered.id;
+
+CREATE INDEX IF NOT EXISTS tasks_room_id_position_idx ON tasks (room_id, position);
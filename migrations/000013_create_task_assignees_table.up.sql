@@ -0,0 +1,7 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS assignment text NOT NULL DEFAULT 'all';
+
+CREATE TABLE IF NOT EXISTS task_assignees (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    PRIMARY KEY (task_id, user_id)
+);
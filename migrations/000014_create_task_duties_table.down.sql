@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_duties;
+ALTER TABLE tasks DROP COLUMN IF EXISTS rotation_policy;
\ No newline at end of file
@@ -0,0 +1,16 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS rotation_policy text NOT NULL DEFAULT 'round-robin';
+
+CREATE TABLE IF NOT EXISTS task_duties (
+    id bigserial PRIMARY KEY,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    started_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ended_at timestamp(0) with time zone,
+    done boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS task_duties_task_id_idx ON task_duties (task_id, started_at);
+
+INSERT INTO task_duties (task_id, user_id)
+SELECT ut.task_id, ut.user_id FROM users_tasks ut
+INNER JOIN tasks t ON t.id = ut.task_id AND t.assignment = 'rotate';
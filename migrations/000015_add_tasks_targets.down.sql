@@ -0,0 +1,4 @@
+ALTER TABLE users_tasks DROP COLUMN IF EXISTS progress;
+ALTER TABLE tasks DROP COLUMN IF EXISTS target;
+ALTER TABLE tasks DROP COLUMN IF EXISTS unit;
+ALTER TABLE tasks DROP COLUMN IF EXISTS kind;
\ No newline at end of file
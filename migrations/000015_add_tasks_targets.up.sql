@@ -0,0 +1,5 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'check';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS unit text NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS target integer NOT NULL DEFAULT 1 CHECK (target > 0);
+
+ALTER TABLE users_tasks ADD COLUMN IF NOT EXISTS progress integer NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS task_history (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    room_id bigint NOT NULL REFERENCES rooms ON DELETE CASCADE,
+    day date NOT NULL,
+    done boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (user_id, task_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS task_history_room_id_idx ON task_history (room_id, day);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS activities (
+    id bigserial PRIMARY KEY,
+    room_id bigint NOT NULL REFERENCES rooms ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    action text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS activities_room_id_idx ON activities (room_id, created_at);
@@ -0,0 +1 @@
+ALTER TABLE rooms_users DROP COLUMN IF EXISTS admin;
@@ -0,0 +1,5 @@
+ALTER TABLE rooms_users ADD COLUMN IF NOT EXISTS admin boolean NOT NULL DEFAULT false;
+
+-- Rooms created so far have no record of their creator and every member
+-- could manage them, so all existing members keep that right.
+UPDATE rooms_users SET admin = true;
@@ -0,0 +1,3 @@
+ALTER TABLE users_tasks DROP COLUMN IF EXISTS proof_id;
+DROP TABLE IF EXISTS proofs;
+ALTER TABLE tasks DROP COLUMN IF EXISTS requires_proof;
@@ -0,0 +1,13 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS requires_proof boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS proofs (
+    id bigserial PRIMARY KEY,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    image_key text NOT NULL,
+    thumb_key text NOT NULL,
+    content_type text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users_tasks ADD COLUMN IF NOT EXISTS proof_id bigint REFERENCES proofs ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE users_tasks DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE users_tasks DROP COLUMN IF EXISTS review;
+ALTER TABLE rooms DROP COLUMN IF EXISTS verification;
@@ -0,0 +1,4 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS verification boolean NOT NULL DEFAULT false;
+
+ALTER TABLE users_tasks ADD COLUMN IF NOT EXISTS review text NOT NULL DEFAULT '';
+ALTER TABLE users_tasks ADD COLUMN IF NOT EXISTS reviewed_by bigint REFERENCES users ON DELETE SET NULL;
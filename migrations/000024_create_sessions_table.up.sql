@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id text PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE,
+    data bytea NOT NULL,
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_seen timestamp with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at timestamp with time zone NOT NULL DEFAULT NOW();
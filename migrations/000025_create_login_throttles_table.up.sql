@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    key text PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure timestamp with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp with time zone
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS email_changes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS muted_notifications;
+ALTER TABLE users DROP COLUMN IF EXISTS time_zone;
@@ -5,4 +5,38 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+var taskOrder = document.querySelector("ol.task-order");
+if (taskOrder) {
+	var dragged = null;
+	taskOrder.addEventListener("dragstart", function(e) {
+		dragged = e.target.closest("li");
+		dragged.classList.add("dragging");
+		e.dataTransfer.effectAllowed = "move";
+	});
+	taskOrder.addEventListener("dragover", function(e) {
+		e.preventDefault();
+		var target = e.target.closest("li");
+		if (!dragged || !target || target === dragged) {
+			return;
+		}
+		var rect = target.getBoundingClientRect();
+		var after = e.clientY > rect.top + rect.height / 2;
+		taskOrder.insertBefore(dragged, after ? target.nextSibling : target);
+	});
+	taskOrder.addEventListener("dragend", function() {
+		if (!dragged) {
+			return;
+		}
+		dragged.classList.remove("dragging");
+		dragged = null;
+
+		var body = new URLSearchParams();
+		body.append("csrf_token", taskOrder.dataset.csrf);
+		var items = taskOrder.querySelectorAll("li");
+		for (var i = 0; i < items.length; i++) {
+			body.append("task", items[i].dataset.id);
+		}
+		fetch(taskOrder.dataset.action, {method: "POST", body: body, credentials: "same-origin"});
+	});
+}